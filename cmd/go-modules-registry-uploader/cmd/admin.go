@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/uploader"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	reason  string
+	message string
+)
+
+var retractCmd = &cobra.Command{
+	Use:   "retract <module> <version>",
+	Short: "Retract a version so it is no longer listed or resolved as the latest version",
+	Long: `Retract a version so the registry no longer lists it or resolves it as the latest version.
+
+This is separate from the retract directive of go.mod files, the go command
+doesn't warn about versions retracted here. Publish a version whose go.mod
+retracts it for that.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := uploader.NewAdmin(registryHost, registryToken()).Retract(args[0], args[1], reason)
+		exitOnError("failed retracting", err)
+	},
+}
+
+var unretractCmd = &cobra.Command{
+	Use:   "unretract <module> <version>",
+	Short: "Undo the retraction of a version",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := uploader.NewAdmin(registryHost, registryToken()).Unretract(args[0], args[1])
+		exitOnError("failed unretracting", err)
+	},
+}
+
+var deprecateCmd = &cobra.Command{
+	Use:   "deprecate <module>",
+	Short: "Deprecate a module that is no longer maintained",
+	Long: `Deprecate a module that is no longer maintained, the message is served in the
+Deprecated field of its version infos.
+
+This is separate from the Deprecated comment of go.mod files, the go command
+doesn't warn about modules deprecated here. Publish a version whose go.mod
+deprecates the module for that.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := uploader.NewAdmin(registryHost, registryToken()).Deprecate(args[0], message)
+		exitOnError("failed deprecating", err)
+	},
+}
+
+var undeprecateCmd = &cobra.Command{
+	Use:   "undeprecate <module>",
+	Short: "Undo the deprecation of a module",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := uploader.NewAdmin(registryHost, registryToken()).Undeprecate(args[0])
+		exitOnError("failed undeprecating", err)
+	},
+}
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete <module> <version>",
+	Short: "Delete a version for good, such as when it leaked a secret. It can never be uploaded again",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := uploader.NewAdmin(registryHost, registryToken()).Delete(args[0], args[1], reason)
+		exitOnError("failed deleting", err)
+	},
+}
+
+func exitOnError(action string, err error) {
+	if err != nil {
+		fmt.Printf("%s: %v\n", action, err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	retractCmd.Flags().StringVar(&reason, "reason", "", "Why the version shouldn't be used")
+	retractCmd.MarkFlagRequired("reason")
+
+	deleteCmd.Flags().StringVar(&reason, "reason", "", "Why the version is being deleted")
+	deleteCmd.MarkFlagRequired("reason")
+
+	deprecateCmd.Flags().StringVar(&message, "message", "", "The deprecation message, usually saying what to use instead")
+	deprecateCmd.MarkFlagRequired("message")
+
+	rootCmd.AddCommand(retractCmd, unretractCmd, deprecateCmd, undeprecateCmd, deleteCmd)
+}
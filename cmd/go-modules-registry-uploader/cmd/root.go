@@ -3,10 +3,11 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
 	"github.com/annymsmthd/go-modules-registry/pkg/uploader"
 
-	"github.com/coreos/go-semver/semver"
 	"github.com/spf13/cobra"
 )
 
@@ -14,16 +15,23 @@ var (
 	registryHost   string
 	version        string
 	moduleLocation string
+	gitRevision    string
+	token          string
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "go-modules-registry-uploader",
-	Short: "go-modules-registry is an uploader to put your git module into the registry",
+	Short: "go-modules-registry is an uploader to put your module into the registry",
 	Long:  "",
 	Run: func(cmd *cobra.Command, args []string) {
-		semversion, err := semver.NewVersion(version)
+		// versions used to be given without the leading v
+		if !strings.HasPrefix(version, "v") {
+			version = "v" + version
+		}
+
+		err := services.CheckVersion(version)
 		if err != nil {
-			fmt.Printf("%s is not a valid semver: %v\n", version, err)
+			fmt.Println(err)
 			os.Exit(1)
 		}
 
@@ -33,8 +41,11 @@ var rootCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		loader := uploader.NewUploader(registryHost, moduleLocation, semversion)
-		err = loader.Upload()
+		loader := uploader.NewUploader(registryHost, moduleLocation, version, gitRevision, registryToken())
+		excluded, err := loader.Upload()
+		for _, e := range excluded {
+			fmt.Printf("excluded %s: %v\n", e.Path, e.Err)
+		}
 		if err != nil {
 			fmt.Printf("failed uploading: %v\n", err)
 			os.Exit(1)
@@ -43,15 +54,25 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
-	rootCmd.Flags().StringVarP(&registryHost, "registry", "r", "", "The location of the module registry")
-	rootCmd.Flags().StringVarP(&version, "version", "v", "", "the version of the module you are uploading. Must be semver")
+	rootCmd.PersistentFlags().StringVarP(&registryHost, "registry", "r", "", "The location of the module registry")
+	rootCmd.Flags().StringVarP(&version, "version", "v", "", "the version of the module you are uploading, such as v1.2.3")
 	rootCmd.Flags().StringVarP(&moduleLocation, "module", "m", "", "The location of the module directory")
+	rootCmd.Flags().StringVar(&gitRevision, "git-revision", "", "Zip the module files committed at this git revision, such as HEAD, instead of the files in the module directory")
+	rootCmd.PersistentFlags().StringVar(&token, "token", "", "The bearer token to authenticate with, defaults to REGISTRY_TOKEN and otherwise the credentials for the registry in .netrc are used")
 
-	rootCmd.MarkFlagRequired("registry")
+	rootCmd.MarkPersistentFlagRequired("registry")
 	rootCmd.MarkFlagRequired("version")
 	rootCmd.MarkFlagRequired("module")
 }
 
+// registryToken is the token flag, falling back to REGISTRY_TOKEN.
+func registryToken() string {
+	if token == "" {
+		return os.Getenv("REGISTRY_TOKEN")
+	}
+	return token
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/server"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+	lstorage "github.com/annymsmthd/go-modules-registry/pkg/storage"
+
+	"github.com/spf13/cobra"
+)
+
+var reindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "rebuilds the module metadata index from everything in storage",
+	Long:  "Rebuilds the module metadata index from everything in storage. The index can't be opened while a server is using it, run the server with --reindex instead then.",
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := newSettings()
+		if settings.IndexPath == "" {
+			fmt.Println("an index location must be given with --index or INDEX_LOCATION")
+			os.Exit(1)
+		}
+
+		storage, err := server.NewStorage(settings)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		index, err := lstorage.NewBoltIndex(settings.IndexPath)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer index.Close()
+
+		count, err := services.NewIndexService(storage, index).Reindex()
+		if err != nil {
+			fmt.Printf("failed reindexing after reading %d versions, the index was left as it was: %v\n", count, err)
+			index.Close()
+			os.Exit(1)
+		}
+
+		fmt.Printf("indexed %d module versions\n", count)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reindexCmd)
+}
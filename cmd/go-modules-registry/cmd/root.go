@@ -5,13 +5,16 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/annymsmthd/go-modules-registry/pkg/logging"
 	"github.com/annymsmthd/go-modules-registry/pkg/server"
+	lstorage "github.com/annymsmthd/go-modules-registry/pkg/storage"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"golang.org/x/sync/errgroup"
 )
 
 var (
@@ -22,11 +25,54 @@ var rootCmd = &cobra.Command{
 	Use:   "go-modules-registry",
 	Short: "go-modules-registry is a self hosted registry for all your private go module needs",
 	Long:  "",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		err := logging.Configure(os.Stderr, viper.GetString("log-format"), viper.GetString("log-level"))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		storage := viper.GetString("storage")
-		settings := &server.Settings{
-			FileStorageBasePath: storage,
-			Port:                *port,
+		settings := newSettings()
+		settings.Port = *port
+		settings.MetricsPort = viper.GetInt("metrics-port")
+		settings.Reindex = viper.GetBool("reindex")
+
+		upstreams, err := parseUpstreams(viper.GetStringSlice("upstream"))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		settings.Upstreams = upstreams
+
+		sumdbs, err := parseSumDBs(viper.GetStringSlice("sumdb"))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		settings.SumDBs = sumdbs
+		settings.SumDBCachePath = viper.GetString("sumdb-cache")
+		settings.AuthTokensPath = viper.GetString("auth-tokens")
+		settings.AuthHtpasswdPath = viper.GetString("auth-htpasswd")
+		settings.AuthJWTPath = viper.GetString("auth-jwt")
+		settings.ReadAuth = viper.GetBool("read-auth")
+		settings.PolicyPath = viper.GetString("policy")
+		settings.AuditLogPath = viper.GetString("audit-log")
+		settings.TLS = server.TLSSettings{
+			CertPath:          viper.GetString("tls-cert"),
+			KeyPath:           viper.GetString("tls-key"),
+			ClientCAPath:      viper.GetString("tls-client-ca"),
+			RequireClientCert: viper.GetBool("tls-require-client-cert"),
+			MinVersion:        viper.GetString("tls-min-version"),
+			CipherSuites:      viper.GetStringSlice("tls-cipher-suites"),
+		}
+		settings.HTTP = server.HTTPSettings{
+			ReadHeaderTimeout:   viper.GetDuration("read-header-timeout"),
+			ReadTimeout:         viper.GetDuration("read-timeout"),
+			WriteTimeout:        viper.GetDuration("write-timeout"),
+			IdleTimeout:         viper.GetDuration("idle-timeout"),
+			MaxHeaderBytes:      viper.GetInt("max-header-bytes"),
+			ShutdownGracePeriod: viper.GetDuration("shutdown-grace-period"),
 		}
 
 		server, err := server.NewServer(settings)
@@ -36,30 +82,157 @@ var rootCmd = &cobra.Command{
 		}
 
 		ctx, cancel := context.WithCancel(context.Background())
-		grp, ctx := errgroup.WithContext(ctx)
 
-		grp.Go(server.Run())
-
-		// Wait for SIGINT/SIGTERM
+		// Drain in-flight requests on SIGINT/SIGTERM
 		waiter := make(chan os.Signal, 1)
 		signal.Notify(waiter, syscall.SIGINT, syscall.SIGTERM)
-		select {
-		case <-waiter:
-		case <-ctx.Done():
-		}
-		cancel()
-		if err := grp.Wait(); err != nil {
-			panic(err)
+		go func() {
+			<-waiter
+			cancel()
+		}()
+
+		err = server.Run(ctx)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
 	},
 }
 
 func init() {
 	port = rootCmd.Flags().IntP("port", "p", 80, "The port to host the server on")
-	rootCmd.Flags().StringP("storage", "s", "/tmp/storage", "The storage location for modules")
+	rootCmd.Flags().Int("metrics-port", 0, "Serve the Prometheus /metrics on this port rather than the main one, to keep them off the network clients use")
+	rootCmd.Flags().Bool("reindex", false, "Rebuild the index from everything in storage before serving, the reindex command can't while the server holds the index")
+	rootCmd.Flags().StringSlice("upstream", []string{}, "Pull modules through from an upstream GOPROXY, given as pattern=url where pattern is a GOPRIVATE style glob such as *=https://proxy.golang.org")
+	rootCmd.Flags().StringSlice("sumdb", []string{}, "Proxy a checksum database, given as name=url such as sum.golang.org=https://sum.golang.org")
+	rootCmd.Flags().String("sumdb-cache", "/tmp/sumdb", "The location to cache checksum database lookups and tiles in, leave empty to disable caching")
+	rootCmd.Flags().String("auth-tokens", "", "A file of name:token lines with the bearer tokens of principals")
+	rootCmd.Flags().String("auth-htpasswd", "", "An htpasswd file with the bcrypt hashed passwords of principals using basic auth")
+	rootCmd.Flags().String("auth-jwt", "", "A YAML file configuring the issuer, audience, JWKS and claim mapping of JSON Web Tokens to accept, such as CI job OIDC tokens")
+	rootCmd.Flags().Bool("read-auth", false, "Require authentication to download modules, the go command sends credentials from .netrc or GOAUTH as basic auth or bearer tokens")
+	rootCmd.Flags().String("policy", "", "A YAML file with the rules for who may read, write and administer which modules, reloaded when it changes. Principals are named token:, htpasswd:, jwt: or cert: followed by the name their credentials give. Leave empty to allow everything")
+	rootCmd.Flags().String("tls-cert", "", "The PEM certificate file to serve HTTPS with, reloaded when it changes. Leave empty to serve plain HTTP")
+	rootCmd.Flags().String("tls-key", "", "The PEM private key file of the tls certificate")
+	rootCmd.Flags().String("tls-client-ca", "", "A PEM file of the CAs whose client certificates authenticate requests, as the certificate's common name in the groups of its organizational units")
+	rootCmd.Flags().Bool("tls-require-client-cert", false, "Reject connections without a client certificate signed by the client CAs")
+	rootCmd.Flags().String("tls-min-version", "1.2", "The minimum TLS version to accept, one of 1.0, 1.1, 1.2 or 1.3")
+	rootCmd.Flags().StringSlice("tls-cipher-suites", []string{}, "The cipher suites allowed up to TLS 1.2 such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, leave empty for Go's defaults")
+	rootCmd.Flags().Duration("read-header-timeout", 10*time.Second, "How long clients get to send request headers")
+	rootCmd.Flags().Duration("read-timeout", 0, "How long clients get to send a whole request including uploaded zips, 0 for no limit so large uploads over slow links aren't cut off")
+	rootCmd.Flags().Duration("write-timeout", 0, "How long the server gets to write a response including downloaded zips, 0 for no limit so large downloads over slow links aren't cut off")
+	rootCmd.Flags().Duration("idle-timeout", 2*time.Minute, "How long keep-alive connections are kept open between requests")
+	rootCmd.Flags().Int("max-header-bytes", 1<<20, "The largest request headers accepted")
+	rootCmd.Flags().Duration("shutdown-grace-period", 30*time.Second, "How long in-flight downloads and uploads get to finish on SIGTERM before their connections are closed, 0 to close them right away")
+	rootCmd.Flags().String("audit-log", "", "The file to append a JSON line to for every publish, delete, retract, deprecation, authentication failure and denied request, leave empty to not keep one")
+	rootCmd.PersistentFlags().String("log-format", "logfmt", "The format of the logs written to stderr, either logfmt or json")
+	rootCmd.PersistentFlags().String("log-level", "info", "The minimum level of the logs to write, one of debug, info, warn or error")
+	rootCmd.PersistentFlags().StringP("storage", "s", "/tmp/storage", "The storage location for modules")
+	rootCmd.PersistentFlags().String("storage-driver", "file", "The storage backend for modules, either file or s3")
+	rootCmd.PersistentFlags().String("s3-endpoint", "", "The endpoint of the S3 compatible storage, leave empty to use AWS")
+	rootCmd.PersistentFlags().String("s3-region", "us-east-1", "The region of the S3 bucket")
+	rootCmd.PersistentFlags().String("s3-bucket", "", "The S3 bucket to store modules in")
+	rootCmd.PersistentFlags().String("s3-prefix", "", "The key prefix to store modules under in the S3 bucket")
+	rootCmd.PersistentFlags().String("s3-access-key-id", "", "The S3 access key id, leave empty to use the default AWS credentials")
+	rootCmd.PersistentFlags().String("s3-secret-access-key", "", "The S3 secret access key")
+	rootCmd.PersistentFlags().String("index", "", "The location of the module metadata index, leave empty to list modules from storage")
+
+	rootCmd.PersistentFlags().String("sumdb-key", "", "The file with the signing key of the registry's own checksum database, leave empty to not keep one")
+	rootCmd.PersistentFlags().String("sumdb-log", "", "The location of the registry's own checksum database log")
+
+	bindFlag("storage", "STORAGE_LOCATION")
+	bindFlag("storage-driver", "STORAGE_DRIVER")
+	bindFlag("s3-endpoint", "S3_ENDPOINT")
+	bindFlag("s3-region", "S3_REGION")
+	bindFlag("s3-bucket", "S3_BUCKET")
+	bindFlag("s3-prefix", "S3_PREFIX")
+	bindFlag("s3-access-key-id", "S3_ACCESS_KEY_ID")
+	bindFlag("s3-secret-access-key", "S3_SECRET_ACCESS_KEY")
+	bindFlag("index", "INDEX_LOCATION")
+	bindFlag("sumdb-key", "SUMDB_KEY_LOCATION")
+	bindFlag("sumdb-log", "SUMDB_LOG_LOCATION")
+	bindFlag("metrics-port", "METRICS_PORT")
+	bindFlag("reindex", "REINDEX")
+	bindFlag("upstream", "UPSTREAMS")
+	bindFlag("sumdb", "SUMDBS")
+	bindFlag("sumdb-cache", "SUMDB_CACHE_LOCATION")
+	bindFlag("auth-tokens", "AUTH_TOKENS_LOCATION")
+	bindFlag("auth-htpasswd", "AUTH_HTPASSWD_LOCATION")
+	bindFlag("auth-jwt", "AUTH_JWT_LOCATION")
+	bindFlag("read-auth", "READ_AUTH")
+	bindFlag("policy", "POLICY_LOCATION")
+	bindFlag("tls-cert", "TLS_CERT_LOCATION")
+	bindFlag("tls-key", "TLS_KEY_LOCATION")
+	bindFlag("tls-client-ca", "TLS_CLIENT_CA_LOCATION")
+	bindFlag("tls-require-client-cert", "TLS_REQUIRE_CLIENT_CERT")
+	bindFlag("tls-min-version", "TLS_MIN_VERSION")
+	bindFlag("tls-cipher-suites", "TLS_CIPHER_SUITES")
+	bindFlag("audit-log", "AUDIT_LOG_LOCATION")
+	bindFlag("read-header-timeout", "READ_HEADER_TIMEOUT")
+	bindFlag("read-timeout", "READ_TIMEOUT")
+	bindFlag("write-timeout", "WRITE_TIMEOUT")
+	bindFlag("idle-timeout", "IDLE_TIMEOUT")
+	bindFlag("max-header-bytes", "MAX_HEADER_BYTES")
+	bindFlag("shutdown-grace-period", "SHUTDOWN_GRACE_PERIOD")
+	bindFlag("log-format", "LOG_FORMAT")
+	bindFlag("log-level", "LOG_LEVEL")
+}
+
+// parseUpstreams parses pattern=url upstream flags, the first matching
+// pattern is used for a module.
+func parseUpstreams(flags []string) ([]server.UpstreamSettings, error) {
+	upstreams := []server.UpstreamSettings{}
+
+	for _, flag := range flags {
+		parts := strings.SplitN(flag, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("upstream %s must be given as pattern=url", flag)
+		}
+
+		upstreams = append(upstreams, server.UpstreamSettings{Pattern: parts[0], URL: parts[1]})
+	}
+
+	return upstreams, nil
+}
+
+// parseSumDBs parses name=url checksum database flags.
+func parseSumDBs(flags []string) ([]server.SumDBSettings, error) {
+	sumdbs := []server.SumDBSettings{}
+
+	for _, flag := range flags {
+		parts := strings.SplitN(flag, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("sumdb %s must be given as name=url", flag)
+		}
+
+		sumdbs = append(sumdbs, server.SumDBSettings{Name: parts[0], URL: parts[1]})
+	}
+
+	return sumdbs, nil
+}
+
+// newSettings creates the server settings shared by every command from the
+// flags and environment.
+func newSettings() *server.Settings {
+	return &server.Settings{
+		StorageDriver:       viper.GetString("storage-driver"),
+		FileStorageBasePath: viper.GetString("storage"),
+		S3: lstorage.S3Config{
+			Endpoint:        viper.GetString("s3-endpoint"),
+			Region:          viper.GetString("s3-region"),
+			Bucket:          viper.GetString("s3-bucket"),
+			Prefix:          viper.GetString("s3-prefix"),
+			AccessKeyID:     viper.GetString("s3-access-key-id"),
+			SecretAccessKey: viper.GetString("s3-secret-access-key"),
+		},
+		IndexPath:    viper.GetString("index"),
+		SumDBKeyPath: viper.GetString("sumdb-key"),
+		SumDBLogPath: viper.GetString("sumdb-log"),
+	}
+}
 
-	viper.BindEnv("storage", "STORAGE_LOCATION")
-	viper.BindPFlag("storage", rootCmd.Flag("storage"))
+func bindFlag(name, env string) {
+	viper.BindEnv(name, env)
+	viper.BindPFlag(name, rootCmd.Flag(name))
 }
 
 func Execute() {
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/server"
+	lstorage "github.com/annymsmthd/go-modules-registry/pkg/storage"
+
+	"github.com/spf13/cobra"
+)
+
+var storageCmd = &cobra.Command{
+	Use:   "storage",
+	Short: "maintains the blobs of file storage",
+}
+
+var storageVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "checks every version's blobs exist and every blob still matches its SHA-256",
+	Run: func(cmd *cobra.Command, args []string) {
+		fileStorage := newFileStorage()
+
+		problems, err := fileStorage.Verify()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("storage is intact")
+	},
+}
+
+var storageGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "removes the blobs no version references, such as those of deleted versions",
+	Run: func(cmd *cobra.Command, args []string) {
+		fileStorage := newFileStorage()
+
+		removed, err := fileStorage.CollectGarbage()
+		if err != nil {
+			fmt.Printf("failed collecting garbage after removing %d blobs: %v\n", removed, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("removed %d blobs\n", removed)
+	},
+}
+
+func newFileStorage() *lstorage.FileStorage {
+	storage, err := server.NewStorage(newSettings())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fileStorage, ok := storage.(*lstorage.FileStorage)
+	if !ok {
+		fmt.Println("only file storage keeps blobs")
+		os.Exit(1)
+	}
+
+	return fileStorage
+}
+
+func init() {
+	storageCmd.AddCommand(storageVerifyCmd)
+	storageCmd.AddCommand(storageGCCmd)
+	rootCmd.AddCommand(storageCmd)
+}
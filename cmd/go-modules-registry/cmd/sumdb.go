@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/server"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/sumdb/note"
+)
+
+var sumdbCmd = &cobra.Command{
+	Use:   "sumdb",
+	Short: "manages the registry's own checksum database",
+}
+
+var sumdbKeygenCmd = &cobra.Command{
+	Use:   "keygen [name]",
+	Short: "generates the signing key of the checksum database, such as keygen registry.example.com",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := newSettings()
+		if settings.SumDBKeyPath == "" {
+			fmt.Println("a key location must be given with --sumdb-key or SUMDB_KEY_LOCATION")
+			os.Exit(1)
+		}
+
+		if _, err := os.Stat(settings.SumDBKeyPath); err == nil {
+			fmt.Printf("%s already exists, refusing to replace the key\n", settings.SumDBKeyPath)
+			os.Exit(1)
+		}
+
+		skey, vkey, err := note.GenerateKey(rand.Reader, args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		err = ioutil.WriteFile(settings.SumDBKeyPath, []byte(skey+"\n"), 0600)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("wrote the signing key to %s, verify modules with\n\n", settings.SumDBKeyPath)
+		fmt.Printf("GOSUMDB=%s\n", vkey)
+	},
+}
+
+var sumdbBackfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "adds every module version in storage that is missing to the checksum database",
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := newSettings()
+		if settings.SumDBKeyPath == "" {
+			fmt.Println("a key location must be given with --sumdb-key or SUMDB_KEY_LOCATION")
+			os.Exit(1)
+		}
+
+		storage, err := server.NewStorage(settings)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		checksums, err := server.NewChecksumDBService(settings, storage, nil, nil)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		count, err := checksums.Backfill()
+		if err != nil {
+			fmt.Printf("failed backfilling after %d versions: %v\n", count, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("checked %d module versions\n", count)
+	},
+}
+
+func init() {
+	sumdbCmd.AddCommand(sumdbKeygenCmd)
+	sumdbCmd.AddCommand(sumdbBackfillCmd)
+	rootCmd.AddCommand(sumdbCmd)
+}
@@ -0,0 +1,15 @@
+package api
+
+// Readiness is whether the registry is ready to serve requests, with the
+// result of each of its checks by name, ok when it passed.
+type Readiness struct {
+	Ready  bool
+	Checks map[string]string
+}
+
+// BuildInfo describes the build of the registry that is running.
+type BuildInfo struct {
+	Version       string
+	Commit        string
+	StorageDriver string
+}
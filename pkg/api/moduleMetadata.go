@@ -0,0 +1,49 @@
+package api
+
+import "time"
+
+// ModuleMetadata is what administrators have recorded about a module and its
+// versions after they were published.
+type ModuleMetadata struct {
+	Deprecation *Deprecation           `json:",omitempty"`
+	Retractions map[string]*Retraction `json:",omitempty"`
+	Deletions   map[string]*Deletion   `json:",omitempty"`
+}
+
+// Deprecation records that a module is no longer maintained, Message usually
+// says what to use instead.
+type Deprecation struct {
+	Message string
+	By      string
+	Time    time.Time
+}
+
+// Retraction records that a version shouldn't be used and why.
+type Retraction struct {
+	Reason string
+	By     string
+	Time   time.Time
+}
+
+// Deletion is the tombstone of a version that was deleted, which can never
+// be uploaded again.
+type Deletion struct {
+	Reason string
+	By     string
+	Time   time.Time
+}
+
+// RetractRequest is the body of a request to retract a version.
+type RetractRequest struct {
+	Reason string
+}
+
+// DeprecateRequest is the body of a request to deprecate a module.
+type DeprecateRequest struct {
+	Message string
+}
+
+// DeleteRequest is the body of a request to delete a version.
+type DeleteRequest struct {
+	Reason string
+}
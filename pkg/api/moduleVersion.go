@@ -0,0 +1,12 @@
+package api
+
+import "time"
+
+// ModuleVersion is the metadata recorded about an uploaded module version.
+type ModuleVersion struct {
+	Module  string
+	Version string
+	Time    time.Time
+	Size    int64
+	SHA256  string
+}
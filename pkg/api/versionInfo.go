@@ -7,4 +7,10 @@ type VersionInfo struct {
 	Short   string
 	Version string
 	Time    time.Time
+
+	// Retracted and Deprecated are only filled in when serving the info,
+	// with the reason the version was retracted and the module deprecated.
+	// The go command ignores them.
+	Retracted  string `json:",omitempty"`
+	Deprecated string `json:",omitempty"`
 }
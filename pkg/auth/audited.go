@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/logging"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/gorilla/mux"
+	gomodule "golang.org/x/mod/module"
+)
+
+// Audited records the requests its authenticator rejects in an audit log.
+type Audited struct {
+	authenticator Authenticator
+	log           services.AuditLog
+}
+
+func NewAudited(authenticator Authenticator, log services.AuditLog) *Audited {
+	return &Audited{authenticator, log}
+}
+
+func (a *Audited) Authenticate(r *http.Request) (*services.Principal, error) {
+	principal, err := a.authenticator.Authenticate(r)
+	if err != nil {
+		a.RecordFailure(r, err)
+		return nil, err
+	}
+
+	return principal, nil
+}
+
+// RecordFailure records a request rejected with err, such as one without
+// credentials where they are required.
+func (a *Audited) RecordFailure(r *http.Request, err error) {
+	vars := mux.Vars(r)
+	module, _ := gomodule.UnescapePath(vars["module"])
+	version, _ := gomodule.UnescapeVersion(vars["version"])
+
+	event := services.NewAuditEvent(r.Context(), services.AuditAuthFailure, module, version, err)
+	event.Detail = fmt.Sprintf("%s %s: %v", r.Method, r.URL.Path, err)
+
+	recordErr := a.log.Record(event)
+	if recordErr != nil {
+		logging.FromContext(r.Context()).WithError(recordErr).Error("failed recording auth failure")
+	}
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"bufio"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/pkg/errors"
+)
+
+// Authenticator identifies the principal making a request. Requests without
+// credentials the authenticator understands give a nil principal and no
+// error, requests with bad credentials give an error of KindUnauthorized.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*services.Principal, error)
+}
+
+// Principal names are prefixed with the kind of credentials that identified
+// them, so the subject of a JWT can't pass for a token holder or user of the
+// same name in the rules of a policy.
+const (
+	tokenPrefix    = "token:"
+	htpasswdPrefix = "htpasswd:"
+	jwtPrefix      = "jwt:"
+	certPrefix     = "cert:"
+)
+
+// FailureRecorder is implemented by authenticators that record the requests
+// they reject, so requests rejected for having no credentials where they are
+// required can be recorded alongside them.
+type FailureRecorder interface {
+	RecordFailure(r *http.Request, err error)
+}
+
+// Chain tries each of its authenticators in turn, the first one to identify
+// the principal wins. Authenticators can share a kind of credentials such as
+// bearer tokens, so when none identify the principal the error of the last
+// one to reject the credentials is returned.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*services.Principal, error) {
+	var lastErr error
+
+	for _, a := range c {
+		principal, err := a.Authenticate(r)
+		if principal != nil && err == nil {
+			return principal, nil
+		}
+		if err != nil {
+			lastErr = err
+		}
+	}
+
+	return nil, lastErr
+}
+
+// readCredentialsFile reads a file of name:secret lines, skipping blank lines
+// and # comments.
+func readCredentialsFile(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed opening credentials file")
+	}
+	defer f.Close()
+
+	credentials := map[string]string{}
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(text, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("%s:%d must be name:secret", file, line)
+		}
+		credentials[parts[0]] = parts[1]
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading credentials file")
+	}
+
+	return credentials, nil
+}
@@ -0,0 +1,117 @@
+package auth_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/auth"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeCredentials(t *testing.T, contents string) string {
+	f, err := ioutil.TempFile("", "credentials")
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = f.WriteString(contents)
+	require.NoError(t, err)
+
+	return f.Name()
+}
+
+func TestChainAuthenticatesTokensAndBasicAuth(t *testing.T) {
+	tokensFile := writeCredentials(t, "# deploy tokens\nci:secret-token\n\nalice:alice-token\n")
+	defer os.Remove(tokensFile)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	require.NoError(t, err)
+	htpasswdFile := writeCredentials(t, "bob:"+string(hash)+"\n")
+	defer os.Remove(htpasswdFile)
+
+	tokens, err := auth.LoadTokenAuthenticator(tokensFile)
+	require.NoError(t, err)
+	basic, err := auth.LoadBasicAuthenticator(htpasswdFile)
+	require.NoError(t, err)
+
+	chain := auth.Chain{tokens, basic}
+
+	tests := []struct {
+		name          string
+		authorization string
+		basicUser     string
+		basicPassword string
+		principal     string
+		kind          services.ErrorKind
+	}{
+		{name: "anonymous"},
+		{name: "token", authorization: "Bearer secret-token", principal: "token:ci"},
+		{name: "lowercase bearer", authorization: "bearer alice-token", principal: "token:alice"},
+		{name: "bad token", authorization: "Bearer wrong", kind: services.KindUnauthorized},
+		{name: "basic", basicUser: "bob", basicPassword: "hunter2", principal: "htpasswd:bob"},
+		{name: "bad password", basicUser: "bob", basicPassword: "wrong", kind: services.KindUnauthorized},
+		{name: "unknown user", basicUser: "eve", basicPassword: "hunter2", kind: services.KindUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			if test.basicUser != "" {
+				r.SetBasicAuth(test.basicUser, test.basicPassword)
+			}
+
+			principal, err := chain.Authenticate(r)
+			if test.kind != services.KindInternal {
+				assert.Equal(t, test.kind, services.KindOf(err))
+				return
+			}
+
+			require.NoError(t, err)
+			if test.principal == "" {
+				assert.Nil(t, principal)
+			} else {
+				require.NotNil(t, principal)
+				assert.Equal(t, test.principal, principal.Name)
+			}
+		})
+	}
+}
+
+func TestLoadTokenAuthenticatorRejectsMalformedFiles(t *testing.T) {
+	file := writeCredentials(t, "ci\n")
+	defer os.Remove(file)
+
+	_, err := auth.LoadTokenAuthenticator(file)
+	assert.Error(t, err)
+}
+
+func TestClientCertAuthenticator(t *testing.T) {
+	authenticator := auth.NewClientCertAuthenticator()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	principal, err := authenticator.Authenticate(r)
+	assert.NoError(t, err)
+	assert.Nil(t, principal)
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ci", OrganizationalUnit: []string{"platform"}}}
+
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	_, err = authenticator.Authenticate(r)
+	assert.Equal(t, services.KindUnauthorized, services.KindOf(err))
+
+	r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	principal, err = authenticator.Authenticate(r)
+	require.NoError(t, err)
+	assert.Equal(t, &services.Principal{Name: "cert:ci", Groups: []string{"platform"}}, principal)
+}
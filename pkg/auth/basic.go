@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BasicAuthenticator authenticates requests with HTTP basic auth against
+// bcrypt password hashes.
+type BasicAuthenticator struct {
+	// bcrypt hashes by user
+	users map[string]string
+}
+
+func NewBasicAuthenticator(users map[string]string) *BasicAuthenticator {
+	return &BasicAuthenticator{users}
+}
+
+// LoadBasicAuthenticator creates a BasicAuthenticator from an htpasswd file
+// with bcrypt hashes, as made by htpasswd -B.
+func LoadBasicAuthenticator(file string) (*BasicAuthenticator, error) {
+	users, err := readCredentialsFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBasicAuthenticator(users), nil
+}
+
+func (a *BasicAuthenticator) Authenticate(r *http.Request) (*services.Principal, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+
+	hash, ok := a.users[user]
+	if !ok {
+		return nil, services.NewErrUnauthorized("invalid username or password")
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		return nil, services.NewErrUnauthorized("invalid username or password")
+	}
+
+	return &services.Principal{Name: htpasswdPrefix + user}, nil
+}
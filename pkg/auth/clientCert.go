@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+)
+
+// ClientCertAuthenticator authenticates requests with the TLS client
+// certificate verified during the handshake. The principal is named cert:
+// and the certificate's common name and is in the groups of its
+// organizational units.
+type ClientCertAuthenticator struct{}
+
+func NewClientCertAuthenticator() *ClientCertAuthenticator {
+	return &ClientCertAuthenticator{}
+}
+
+func (a *ClientCertAuthenticator) Authenticate(r *http.Request) (*services.Principal, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, nil
+	}
+
+	// the handshake only leaves certificates unverified when the server
+	// wasn't configured to verify them
+	if len(r.TLS.VerifiedChains) == 0 {
+		return nil, services.NewErrUnauthorized("client certificate was not verified")
+	}
+
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	if subject.CommonName == "" {
+		return nil, services.NewErrUnauthorized("client certificate has no common name")
+	}
+
+	return &services.Principal{Name: certPrefix + subject.CommonName, Groups: subject.OrganizationalUnit}, nil
+}
@@ -0,0 +1,12 @@
+package auth
+
+import "time"
+
+// BackdateKeySetFetch moves the last fetch of the key set of a back by d, to
+// test refetching without waiting.
+func BackdateKeySetFetch(a *JWTAuthenticator, d time.Duration) {
+	a.keys.mu.Lock()
+	defer a.keys.mu.Unlock()
+
+	a.keys.fetched = a.keys.fetched.Add(-d)
+}
@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+// keySetRefresh is how often a key set is fetched again, and the least time
+// between fetches when a token is signed with an unknown key.
+const (
+	keySetRefresh    = time.Hour
+	keySetMinRefresh = time.Minute
+)
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// KeySet is a JSON Web Key Set read from a file or URL, refetched
+// periodically and when asked for a key it doesn't have so that keys can be
+// rotated. Fetches happen one at a time without holding up lookups of the
+// keys already known.
+type KeySet struct {
+	location string
+	client   *http.Client
+	fetches  singleflight.Group
+
+	mu      sync.RWMutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// NewKeySet creates a KeySet from location, an http(s) URL or a file path.
+func NewKeySet(location string) (*KeySet, error) {
+	s := &KeySet{
+		location: location,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+
+	err := s.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Key returns the key with id kid, or the only key of the set when kid is
+// empty.
+func (s *KeySet) Key(kid string) (crypto.PublicKey, error) {
+	s.mu.RLock()
+	key, ok := s.lookup(kid)
+	sinceFetch := time.Since(s.fetched)
+	s.mu.RUnlock()
+
+	if ok {
+		// refresh stale keys in the background, the known key is still good
+		if sinceFetch > keySetRefresh {
+			go s.fetches.Do("refresh", func() (interface{}, error) {
+				return nil, s.refresh()
+			})
+		}
+		return key, nil
+	}
+
+	if sinceFetch > keySetMinRefresh {
+		_, err, _ := s.fetches.Do("refresh", func() (interface{}, error) {
+			return nil, s.refresh()
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		s.mu.RLock()
+		key, ok = s.lookup(kid)
+		s.mu.RUnlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("no key %q in key set", kid)
+	}
+
+	return key, nil
+}
+
+// lookup must be called holding mu.
+func (s *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// refresh fetches the key set without holding mu, so lookups carry on while
+// a slow key set is fetched.
+func (s *KeySet) refresh() error {
+	// count failed fetches too so an unreachable key set isn't hammered
+	s.mu.Lock()
+	s.fetched = time.Now()
+	s.mu.Unlock()
+
+	data, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseKeySet(data)
+	if err != nil {
+		return errors.Wrapf(err, "invalid key set %s", s.location)
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *KeySet) read() ([]byte, error) {
+	if !strings.HasPrefix(s.location, "http://") && !strings.HasPrefix(s.location, "https://") {
+		data, err := ioutil.ReadFile(s.location)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading key set")
+		}
+		return data, nil
+	}
+
+	resp, err := s.client.Get(s.location)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed fetching key set %s", s.location)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed reading key set %s", s.location)
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("expected status code 200 but got %v for key set %s", resp.StatusCode, s.location)
+	}
+
+	return data, nil
+}
+
+// parseKeySet parses the RSA and EC signing keys of a key set, skipping keys
+// of other types or uses.
+func parseKeySet(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err := json.Unmarshal(data, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		switch jwk.Kty {
+		case "RSA":
+			key, err = parseRSAKey(jwk)
+		case "EC":
+			key, err = parseECKey(jwk)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key %q", jwk.Kid)
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func parseRSAKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid modulus")
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid exponent")
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Int64() < 3 {
+		return nil, fmt.Errorf("unsupported exponent")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+func parseECKey(jwk jsonWebKey) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch jwk.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid x coordinate")
+	}
+
+	y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid y coordinate")
+	}
+
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, fmt.Errorf("point is not on curve %s", jwk.Crv)
+	}
+
+	return key, nil
+}
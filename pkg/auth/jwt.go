@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// clockSkew is how far the clocks of token issuers and the registry may be
+// apart.
+const clockSkew = time.Minute
+
+var signingHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// ecCurves are the curves of the keys each EC algorithm is defined for.
+var ecCurves = map[string]string{
+	"ES256": "P-256",
+	"ES384": "P-384",
+	"ES512": "P-521",
+}
+
+var claimTemplate = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// JWTConfig configures which JSON Web Tokens a JWTAuthenticator accepts and
+// how their claims map to the principal.
+type JWTConfig struct {
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// JWKS is the URL or file of the key set tokens are signed with.
+	JWKS string `yaml:"jwks"`
+	// PrincipalClaim names the principal, sub by default.
+	PrincipalClaim string `yaml:"principal_claim"`
+	// GroupClaims are claims whose values are groups of the principal, for
+	// use in policies.
+	GroupClaims []string `yaml:"group_claims"`
+	// Modules limits the writes of principals to the module paths matching
+	// these GOPRIVATE style patterns, with {claim} replaced by the value of
+	// the claim. For example corp.example/{repository} only lets the CI job
+	// of a repository publish the modules of that repository.
+	Modules []string `yaml:"modules"`
+}
+
+// JWTAuthenticator authenticates requests with bearer JSON Web Tokens, such
+// as the OIDC tokens CI systems issue to jobs, signed by a key in a JWKS.
+type JWTAuthenticator struct {
+	config *JWTConfig
+	keys   *KeySet
+}
+
+func NewJWTAuthenticator(config *JWTConfig) (*JWTAuthenticator, error) {
+	if config.Issuer == "" || config.Audience == "" || config.JWKS == "" {
+		return nil, fmt.Errorf("jwt authentication needs an issuer, audience and jwks")
+	}
+
+	for _, pattern := range config.Modules {
+		if !claimTemplate.MatchString(pattern) {
+			return nil, fmt.Errorf("module pattern %s doesn't use any claims", pattern)
+		}
+	}
+
+	keys, err := NewKeySet(config.JWKS)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JWTAuthenticator{config, keys}, nil
+}
+
+// LoadJWTAuthenticator creates a JWTAuthenticator from a YAML file with a
+// JWTConfig.
+func LoadJWTAuthenticator(file string) (*JWTAuthenticator, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading jwt config")
+	}
+
+	var config JWTConfig
+	err = yaml.UnmarshalStrict(data, &config)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed parsing jwt config")
+	}
+
+	return NewJWTAuthenticator(&config)
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*services.Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok || strings.Count(token, ".") != 2 {
+		return nil, nil
+	}
+
+	claims, err := a.verify(token)
+	if err != nil {
+		return nil, services.NewErrUnauthorized("invalid token: %v", err)
+	}
+
+	principal, err := a.principal(claims)
+	if err != nil {
+		return nil, services.NewErrUnauthorized("invalid token: %v", err)
+	}
+
+	return principal, nil
+}
+
+// verify checks the signature and registered claims of token, returning its
+// claims.
+func (a *JWTAuthenticator) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed header")
+	}
+
+	hash, ok := signingHashes[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+
+	key, err := a.keys.Key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed signature")
+	}
+
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	err = verifySignature(header.Alg, key, hash, h.Sum(nil), signature)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{}
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed claims")
+	}
+
+	if iss, _ := claims["iss"].(string); iss != a.config.Issuer {
+		return nil, fmt.Errorf("issuer %q is not trusted", iss)
+	}
+
+	if !hasAudience(claims["aud"], a.config.Audience) {
+		return nil, fmt.Errorf("token is not for audience %q", a.config.Audience)
+	}
+
+	now := time.Now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return nil, fmt.Errorf("token has expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("token is not valid yet")
+	}
+
+	return claims, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, hash crypto.Hash, digest, signature []byte) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("algorithm %s doesn't match the RSA key", alg)
+		}
+		if rsa.VerifyPKCS1v15(k, hash, digest, signature) != nil {
+			return fmt.Errorf("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if ecCurves[alg] != k.Curve.Params().Name || len(signature) != 2*size {
+			return fmt.Errorf("algorithm %s doesn't match the EC key on %s", alg, k.Curve.Params().Name)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+
+	return nil
+}
+
+// principal maps the claims of a verified token to the principal.
+func (a *JWTAuthenticator) principal(claims map[string]interface{}) (*services.Principal, error) {
+	nameClaim := a.config.PrincipalClaim
+	if nameClaim == "" {
+		nameClaim = "sub"
+	}
+
+	name, ok := claims[nameClaim].(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("claim %s is missing", nameClaim)
+	}
+
+	principal := &services.Principal{Name: jwtPrefix + name}
+
+	for _, claim := range a.config.GroupClaims {
+		switch v := claims[claim].(type) {
+		case string:
+			principal.Groups = append(principal.Groups, v)
+		case []interface{}:
+			for _, g := range v {
+				if group, ok := g.(string); ok {
+					principal.Groups = append(principal.Groups, group)
+				}
+			}
+		}
+	}
+
+	for _, pattern := range a.config.Modules {
+		modules, err := expandClaims(pattern, claims)
+		if err != nil {
+			return nil, err
+		}
+		principal.Modules = append(principal.Modules, modules)
+	}
+
+	return principal, nil
+}
+
+// expandClaims replaces the {claim} placeholders of pattern. Claims with
+// glob characters are rejected so a claim can't widen the pattern.
+func expandClaims(pattern string, claims map[string]interface{}) (string, error) {
+	var err error
+
+	expanded := claimTemplate.ReplaceAllStringFunc(pattern, func(placeholder string) string {
+		claim := placeholder[1 : len(placeholder)-1]
+
+		value, ok := claims[claim].(string)
+		if !ok || value == "" {
+			err = fmt.Errorf("claim %s is missing", claim)
+			return ""
+		}
+		if strings.ContainsAny(value, `*?[]\,`) {
+			err = fmt.Errorf("claim %s has characters not allowed in module paths", claim)
+			return ""
+		}
+
+		return value
+	})
+
+	return expanded, err
+}
+
+func hasAudience(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, a := range v {
+			if a == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
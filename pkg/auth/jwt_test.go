@@ -0,0 +1,227 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/auth"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSigner struct {
+	kid string
+	alg string
+	key crypto.Signer
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (s *testSigner) jwk() map[string]string {
+	switch k := s.key.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": s.kid, "use": "sig", "n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": s.kid, "crv": "P-256", "x": b64(k.X.Bytes()), "y": b64(k.Y.Bytes())}
+	}
+	return nil
+}
+
+func (s *testSigner) sign(t *testing.T, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": s.alg, "kid": s.kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signingInput := b64(header) + "." + b64(payload)
+
+	// sign with the hash of the alg whatever the key, to make tokens whose
+	// alg doesn't match their key
+	hash := crypto.SHA256
+	switch s.alg[len(s.alg)-3:] {
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	}
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	var signature []byte
+	switch k := s.key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, hash, digest)
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest)
+		require.NoError(t, err)
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+	}
+
+	return signingInput + "." + b64(signature)
+}
+
+func keySet(t *testing.T, signers ...*testSigner) []byte {
+	keys := []map[string]string{}
+	for _, s := range signers {
+		keys = append(keys, s.jwk())
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	require.NoError(t, err)
+
+	return data
+}
+
+func authenticateToken(a auth.Authenticator, token string) (*services.Principal, error) {
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return a.Authenticate(r)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	rsaSigner := &testSigner{"rsa", "RS256", rsaKey}
+	ecSigner := &testSigner{"ec", "ES256", ecKey}
+	otherSigner := &testSigner{"rsa", "RS256", otherKey}
+
+	jwks := writeCredentials(t, string(keySet(t, rsaSigner, ecSigner)))
+	defer os.Remove(jwks)
+
+	authenticator, err := auth.NewJWTAuthenticator(&auth.JWTConfig{
+		Issuer:      "https://ci.example.com",
+		Audience:    "registry",
+		JWKS:        jwks,
+		GroupClaims: []string{"teams"},
+		Modules:     []string{"corp.example/{repository}"},
+	})
+	require.NoError(t, err)
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":        "https://ci.example.com",
+			"aud":        []string{"registry", "other"},
+			"sub":        "repo:payments/api:ref:main",
+			"exp":        time.Now().Add(time.Hour).Unix(),
+			"repository": "payments/api",
+			"teams":      []string{"payments"},
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	principal, err := authenticateToken(authenticator, rsaSigner.sign(t, claims(nil)))
+	require.NoError(t, err)
+	assert.Equal(t, &services.Principal{
+		Name:    "jwt:repo:payments/api:ref:main",
+		Groups:  []string{"payments"},
+		Modules: []string{"corp.example/payments/api"},
+	}, principal)
+
+	principal, err = authenticateToken(authenticator, ecSigner.sign(t, claims(nil)))
+	require.NoError(t, err)
+	assert.Equal(t, "jwt:repo:payments/api:ref:main", principal.Name)
+
+	for name, token := range map[string]string{
+		"expired":         rsaSigner.sign(t, claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"no expiry":       rsaSigner.sign(t, claims(map[string]interface{}{"exp": nil})),
+		"not yet valid":   rsaSigner.sign(t, claims(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()})),
+		"wrong issuer":    rsaSigner.sign(t, claims(map[string]interface{}{"iss": "https://evil.example.com"})),
+		"wrong audience":  rsaSigner.sign(t, claims(map[string]interface{}{"aud": "other"})),
+		"wrong key":       otherSigner.sign(t, claims(nil)),
+		"missing claim":   rsaSigner.sign(t, claims(map[string]interface{}{"repository": nil})),
+		"glob in claim":   rsaSigner.sign(t, claims(map[string]interface{}{"repository": "*"})),
+		"unsupported alg": (&testSigner{"rsa", "none", rsaKey}).sign(t, claims(nil)),
+		"alg of rsa key":  (&testSigner{"ec", "RS256", rsaKey}).sign(t, claims(nil)),
+		"alg of curve":    (&testSigner{"ec", "ES384", ecKey}).sign(t, claims(nil)),
+	} {
+		_, err := authenticateToken(authenticator, token)
+		assert.Equal(t, services.KindUnauthorized, services.KindOf(err), name)
+	}
+
+	// static tokens aren't JWTs and are left to other authenticators
+	principal, err = authenticateToken(authenticator, "static-token")
+	assert.NoError(t, err)
+	assert.Nil(t, principal)
+}
+
+func TestJWTAuthenticatorFetchesRotatedKeys(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	oldSigner := &testSigner{"old", "RS256", oldKey}
+
+	jwks := keySet(t, oldSigner)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(jwks)
+	}))
+	defer server.Close()
+
+	authenticator, err := auth.NewJWTAuthenticator(&auth.JWTConfig{
+		Issuer:   "https://ci.example.com",
+		Audience: "registry",
+		JWKS:     server.URL,
+	})
+	require.NoError(t, err)
+
+	claims := map[string]interface{}{
+		"iss": "https://ci.example.com",
+		"aud": "registry",
+		"sub": "job",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	principal, err := authenticateToken(authenticator, oldSigner.sign(t, claims))
+	require.NoError(t, err)
+	assert.Equal(t, "jwt:job", principal.Name)
+
+	// keys are only refetched a while after the last fetch
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newSigner := &testSigner{"new", "RS256", newKey}
+	jwks = keySet(t, oldSigner, newSigner)
+
+	_, err = authenticateToken(authenticator, newSigner.sign(t, claims))
+	assert.Equal(t, services.KindUnauthorized, services.KindOf(err))
+
+	// and once they are the rotated key is accepted
+	auth.BackdateKeySetFetch(authenticator, 2*time.Minute)
+
+	principal, err = authenticateToken(authenticator, newSigner.sign(t, claims))
+	require.NoError(t, err)
+	assert.Equal(t, "jwt:job", principal.Name)
+
+	principal, err = authenticateToken(authenticator, oldSigner.sign(t, claims))
+	require.NoError(t, err)
+	assert.Equal(t, "jwt:job", principal.Name)
+}
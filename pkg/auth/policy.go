@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+	"github.com/annymsmthd/go-modules-registry/pkg/watch"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/module"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Everyone is the principal name in policy rules matching every request,
+// including anonymous ones.
+const Everyone = "*"
+
+var actions = map[string]services.Action{
+	"read":  services.ActionRead,
+	"write": services.ActionWrite,
+	"admin": services.ActionAdmin,
+}
+
+// Policy grants actions on module paths to principals and groups. Anything
+// not granted by a rule is denied. Principals are named after the kind of
+// credentials that identified them: token:, htpasswd:, jwt: or cert: and the
+// name the credentials give.
+type Policy struct {
+	// Groups are the members of each group by group name, on top of the
+	// groups principals get from their credentials such as JWT claims and
+	// certificate organizational units, which rules can name without them
+	// being listed here.
+	Groups map[string][]string `yaml:"groups"`
+	Rules  []*PolicyRule       `yaml:"rules"`
+}
+
+// PolicyRule grants Action on the module paths matching Modules, a comma
+// separated list of GOPRIVATE style glob patterns, to Principals and the
+// members of Groups.
+type PolicyRule struct {
+	Modules    string   `yaml:"modules"`
+	Principals []string `yaml:"principals"`
+	Groups     []string `yaml:"groups"`
+	Action     string   `yaml:"action"`
+
+	action services.Action
+}
+
+// ParsePolicy parses a YAML policy such as
+//
+//	groups:
+//	  payments: ["htpasswd:alice", "jwt:bob"]
+//	rules:
+//	  - modules: corp.example/payments
+//	    groups: [payments]
+//	    action: write
+//	  - modules: corp.example/payments
+//	    principals: ["token:ci"]
+//	    action: read
+//	  - modules: corp.example
+//	    principals: ["*"]
+//	    action: read
+func ParsePolicy(data []byte) (*Policy, error) {
+	var policy Policy
+	err := yaml.UnmarshalStrict(data, &policy)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed parsing policy")
+	}
+
+	// a policy without rules denies everything, which is more likely a file
+	// caught halfway through being written than what was meant
+	if len(policy.Rules) == 0 {
+		return nil, fmt.Errorf("policy has no rules")
+	}
+
+	for i, rule := range policy.Rules {
+		if rule.Modules == "" {
+			return nil, fmt.Errorf("rule %d must match modules", i+1)
+		}
+
+		action, ok := actions[rule.Action]
+		if !ok {
+			return nil, fmt.Errorf("rule %d has action %q, it must be read, write or admin", i+1, rule.Action)
+		}
+		rule.action = action
+	}
+
+	return &policy, nil
+}
+
+func (p *Policy) Allowed(principal *services.Principal, action services.Action, modulePath string) bool {
+	for _, rule := range p.Rules {
+		if rule.action >= action && module.MatchPrefixPatterns(rule.Modules, modulePath) && p.grants(rule, principal) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) grants(rule *PolicyRule, principal *services.Principal) bool {
+	for _, name := range rule.Principals {
+		if name == Everyone || (principal != nil && name == principal.Name) {
+			return true
+		}
+	}
+
+	if principal == nil {
+		return false
+	}
+
+	for _, group := range rule.Groups {
+		for _, g := range principal.Groups {
+			if g == group {
+				return true
+			}
+		}
+		for _, member := range p.Groups[group] {
+			if member == principal.Name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// PolicyFile is an Authorizer using the policy in a file, which is reloaded
+// whenever it changes. A policy that fails to load leaves the last one in
+// place.
+type PolicyFile struct {
+	file    string
+	mu      sync.RWMutex
+	policy  *Policy
+	watcher *watch.Watcher
+}
+
+func LoadPolicyFile(file string) (*PolicyFile, error) {
+	f := &PolicyFile{file: file}
+
+	err := f.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	f.watcher, err = watch.Files("policy", []string{file}, f.Reload)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *PolicyFile) Reload() error {
+	data, err := ioutil.ReadFile(f.file)
+	if err != nil {
+		return errors.Wrap(err, "failed reading policy file")
+	}
+
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		return errors.Wrapf(err, "invalid policy file %s", f.file)
+	}
+
+	f.mu.Lock()
+	f.policy = policy
+	f.mu.Unlock()
+
+	return nil
+}
+
+// Close stops watching the policy file for changes.
+func (f *PolicyFile) Close() error {
+	return f.watcher.Close()
+}
+
+func (f *PolicyFile) Allowed(principal *services.Principal, action services.Action, modulePath string) bool {
+	f.mu.RLock()
+	policy := f.policy
+	f.mu.RUnlock()
+
+	return policy.Allowed(principal, action, modulePath)
+}
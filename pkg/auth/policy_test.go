@@ -0,0 +1,126 @@
+package auth_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/auth"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+groups:
+  payments: ["htpasswd:alice"]
+rules:
+  - modules: corp.example/payments
+    groups: [payments]
+    action: write
+  - modules: corp.example/*/internal
+    principals: ["token:ci"]
+    action: admin
+  - modules: corp.example/platform
+    groups: [platform]
+    action: write
+  - modules: corp.example
+    principals: ["*"]
+    action: read
+`
+
+func TestPolicyAllowed(t *testing.T) {
+	policy, err := auth.ParsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+
+	alice := &services.Principal{Name: "htpasswd:alice"}
+	bob := &services.Principal{Name: "htpasswd:bob"}
+	ci := &services.Principal{Name: "token:ci"}
+	impostor := &services.Principal{Name: "jwt:ci"}
+	payments := &services.Principal{Name: "jwt:job-1", Groups: []string{"payments"}}
+	platform := &services.Principal{Name: "cert:deploy", Groups: []string{"platform"}}
+
+	tests := []struct {
+		principal *services.Principal
+		action    services.Action
+		module    string
+		allowed   bool
+	}{
+		{nil, services.ActionRead, "corp.example/payments", true},
+		{nil, services.ActionRead, "other.example/module", false},
+		{nil, services.ActionWrite, "corp.example/payments", false},
+		{alice, services.ActionWrite, "corp.example/payments/v2", true},
+		{alice, services.ActionAdmin, "corp.example/payments", false},
+		{payments, services.ActionWrite, "corp.example/payments", true},
+		{bob, services.ActionRead, "corp.example/payments", true},
+		{bob, services.ActionWrite, "corp.example/payments", false},
+		{ci, services.ActionAdmin, "corp.example/tools/internal/x", true},
+		{ci, services.ActionWrite, "corp.example/tools", false},
+		{impostor, services.ActionAdmin, "corp.example/tools/internal/x", false},
+		{platform, services.ActionWrite, "corp.example/platform", true},
+		{bob, services.ActionWrite, "corp.example/platform", false},
+	}
+
+	for _, test := range tests {
+		name := "anonymous"
+		if test.principal != nil {
+			name = test.principal.Name
+		}
+		assert.Equal(t, test.allowed, policy.Allowed(test.principal, test.action, test.module), "%s %s %s", name, test.action, test.module)
+	}
+}
+
+func TestParsePolicyRejectsInvalidPolicies(t *testing.T) {
+	for _, policy := range []string{
+		"",
+		"rules:\n  - modules: corp.example\n    action: delete\n",
+		"rules:\n  - action: read\n",
+		"rule:\n  - modules: corp.example\n    action: read\n",
+	} {
+		_, err := auth.ParsePolicy([]byte(policy))
+		assert.Error(t, err, policy)
+	}
+}
+
+func TestPolicyFileReloads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "policy.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(testPolicy), 0644))
+
+	policy, err := auth.LoadPolicyFile(file)
+	require.NoError(t, err)
+	defer policy.Close()
+
+	bob := &services.Principal{Name: "htpasswd:bob"}
+	assert.False(t, policy.Allowed(bob, services.ActionWrite, "corp.example/tools"))
+
+	// replace the file like an editor would
+	tmp := filepath.Join(dir, "policy.yaml.tmp")
+	require.NoError(t, ioutil.WriteFile(tmp, []byte("rules:\n  - modules: corp.example\n    principals: [\"htpasswd:bob\"]\n    action: write\n"), 0644))
+	require.NoError(t, os.Rename(tmp, file))
+
+	assert.True(t, eventually(func() bool {
+		return policy.Allowed(bob, services.ActionWrite, "corp.example/tools")
+	}), "policy was not reloaded")
+
+	// invalid policies keep the last one in place
+	require.NoError(t, ioutil.WriteFile(file, []byte("rules: ["), 0644))
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, policy.Allowed(bob, services.ActionWrite, "corp.example/tools"))
+}
+
+func eventually(condition func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if condition() {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+)
+
+// TokenAuthenticator authenticates requests with static bearer tokens in the
+// Authorization header.
+type TokenAuthenticator struct {
+	// principal names by token
+	tokens map[string]string
+}
+
+// NewTokenAuthenticator creates a TokenAuthenticator from tokens keyed by
+// the name of the principal they belong to.
+func NewTokenAuthenticator(tokens map[string]string) *TokenAuthenticator {
+	byToken := map[string]string{}
+	for name, token := range tokens {
+		byToken[token] = name
+	}
+
+	return &TokenAuthenticator{byToken}
+}
+
+// LoadTokenAuthenticator creates a TokenAuthenticator from a file with a
+// name:token line per principal.
+func LoadTokenAuthenticator(file string) (*TokenAuthenticator, error) {
+	tokens, err := readCredentialsFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTokenAuthenticator(tokens), nil
+}
+
+func (a *TokenAuthenticator) Authenticate(r *http.Request) (*services.Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, nil
+	}
+
+	// compare against every token so the time taken doesn't tell how close
+	// a guess was
+	name := ""
+	for t, n := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			name = n
+		}
+	}
+
+	if name == "" {
+		return nil, services.NewErrUnauthorized("invalid token")
+	}
+
+	return &services.Principal{Name: tokenPrefix + name}, nil
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < len("Bearer ") || !strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+
+	return strings.TrimSpace(header[len("Bearer "):]), true
+}
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
+	"github.com/annymsmthd/go-modules-registry/pkg/auth"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/gorilla/mux"
+)
+
+type AdminRouter struct {
+	service       *services.AdminService
+	authenticator auth.Authenticator
+}
+
+// NewAdminRouter creates an AdminRouter only accepting requests from
+// principals authenticator identifies, authenticator may be nil to accept
+// anonymous requests.
+func NewAdminRouter(service *services.AdminService, authenticator auth.Authenticator) *AdminRouter {
+	return &AdminRouter{service, authenticator}
+}
+
+func (a *AdminRouter) Register(router *mux.Router) {
+	router.HandleFunc("/_modules/{module:.*}/@metadata", authenticate(a.authenticator, true, a.metadata)).Methods(http.MethodGet)
+	router.HandleFunc("/_modules/{module:.*}/@deprecation", authenticate(a.authenticator, true, a.deprecate)).Methods(http.MethodPut)
+	router.HandleFunc("/_modules/{module:.*}/@deprecation", authenticate(a.authenticator, true, a.undeprecate)).Methods(http.MethodDelete)
+	router.HandleFunc("/_modules/{module:.*}/@v/{version}/retraction", authenticate(a.authenticator, true, a.retract)).Methods(http.MethodPut)
+	router.HandleFunc("/_modules/{module:.*}/@v/{version}/retraction", authenticate(a.authenticator, true, a.unretract)).Methods(http.MethodDelete)
+	router.HandleFunc("/_modules/{module:.*}/@v/{version}", authenticate(a.authenticator, true, a.delete)).Methods(http.MethodDelete)
+}
+
+func (a *AdminRouter) metadata(w http.ResponseWriter, r *http.Request) {
+	module, err := moduleFromVars(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	metadata, err := a.service.Metadata(r.Context(), module)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = respondWithJSON(w, 200, metadata)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+}
+
+func (a *AdminRouter) deprecate(w http.ResponseWriter, r *http.Request) {
+	module, err := moduleFromVars(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var request api.DeprecateRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		respondWithError(w, r, services.NewErrInvalid("invalid deprecation: %v", err))
+		return
+	}
+
+	err = a.service.Deprecate(r.Context(), module, request.Message)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+func (a *AdminRouter) undeprecate(w http.ResponseWriter, r *http.Request) {
+	module, err := moduleFromVars(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = a.service.Undeprecate(r.Context(), module)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+func (a *AdminRouter) retract(w http.ResponseWriter, r *http.Request) {
+	module, version, err := moduleAndVersion(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var request api.RetractRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		respondWithError(w, r, services.NewErrInvalid("invalid retraction: %v", err))
+		return
+	}
+
+	err = a.service.Retract(r.Context(), module, version, request.Reason)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+func (a *AdminRouter) unretract(w http.ResponseWriter, r *http.Request) {
+	module, version, err := moduleAndVersion(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = a.service.Unretract(r.Context(), module, version)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+func (a *AdminRouter) delete(w http.ResponseWriter, r *http.Request) {
+	module, version, err := moduleAndVersion(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	var request api.DeleteRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		respondWithError(w, r, services.NewErrInvalid("invalid deletion: %v", err))
+		return
+	}
+
+	err = a.service.Delete(r.Context(), module, version, request.Reason)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,38 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/auth"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+)
+
+// authenticate puts the principal authenticator identifies for requests in
+// the request context before passing them on to next. Requests with bad
+// credentials are rejected, as are requests without any when required. A nil
+// authenticator lets every request through anonymously.
+func authenticate(authenticator auth.Authenticator, required bool, next http.HandlerFunc) http.HandlerFunc {
+	if authenticator == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := authenticator.Authenticate(r)
+		if err == nil && principal == nil && required {
+			err = services.NewErrUnauthorized("authentication required")
+			if recorder, ok := authenticator.(auth.FailureRecorder); ok {
+				recorder.RecordFailure(r, err)
+			}
+		}
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		if principal != nil {
+			r = r.WithContext(services.ContextWithPrincipal(r.Context(), principal))
+		}
+
+		next(w, r)
+	}
+}
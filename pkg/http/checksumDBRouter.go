@@ -0,0 +1,60 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/auth"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/gorilla/mux"
+	gomodule "golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb"
+)
+
+// ChecksumDBRouter serves the registry's own checksum database under the
+// sumdb proxy paths of the GOPROXY protocol, so clients can verify modules
+// with GOSUMDB set to its name and key.
+type ChecksumDBRouter struct {
+	service       *services.ChecksumDBService
+	authenticator auth.Authenticator
+	requireAuth   bool
+}
+
+// NewChecksumDBRouter creates a ChecksumDBRouter, only serving principals
+// authenticator identifies when requireAuth is set. Tiles hold the hashes of
+// every module, so requireAuth should be set whenever reads are authorized.
+func NewChecksumDBRouter(service *services.ChecksumDBService, authenticator auth.Authenticator, requireAuth bool) *ChecksumDBRouter {
+	return &ChecksumDBRouter{service, authenticator, requireAuth}
+}
+
+func (c *ChecksumDBRouter) Register(router *mux.Router) {
+	prefix := "/_modulesproxy/sumdb/" + c.service.Name()
+	server := http.StripPrefix(prefix, sumdb.NewServer(c.service))
+
+	router.HandleFunc(prefix+"/supported", authenticate(c.authenticator, c.requireAuth, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	router.PathPrefix(prefix + "/lookup/").HandlerFunc(authenticate(c.authenticator, c.requireAuth, func(w http.ResponseWriter, r *http.Request) {
+		c.lookup(server, w, r)
+	}))
+	router.PathPrefix(prefix + "/").HandlerFunc(authenticate(c.authenticator, c.requireAuth, server.ServeHTTP))
+}
+
+// lookup authorizes lookups before the sumdb server, which reports every
+// error but not found as a 500.
+func (c *ChecksumDBRouter) lookup(server http.Handler, w http.ResponseWriter, r *http.Request) {
+	mod := r.URL.Path[strings.LastIndex(r.URL.Path, "/lookup/")+len("/lookup/"):]
+	if i := strings.Index(mod, "@"); i >= 0 {
+		module, err := gomodule.UnescapePath(mod[:i])
+		if err == nil {
+			err = c.service.AuthorizeLookup(r.Context(), module)
+			if err != nil {
+				respondWithError(w, r, err)
+				return
+			}
+		}
+	}
+
+	server.ServeHTTP(w, r)
+}
@@ -0,0 +1,174 @@
+package http_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/auth"
+	lhttp "github.com/annymsmthd/go-modules-registry/pkg/http"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+	"github.com/annymsmthd/go-modules-registry/pkg/storage"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// testClientOps is an in memory sumdb.ClientOps reading from a router.
+type testClientOps struct {
+	t      *testing.T
+	router *mux.Router
+	prefix string
+	mu     sync.Mutex
+	config map[string][]byte
+}
+
+func (c *testClientOps) ReadRemote(path string) ([]byte, error) {
+	w := serve(c.router, http.MethodGet, c.prefix+path, nil)
+	if w.Code != 200 {
+		return nil, fmt.Errorf("%s: %d %s", path, w.Code, w.Body.String())
+	}
+	return w.Body.Bytes(), nil
+}
+
+func (c *testClientOps) ReadConfig(file string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config[file], nil
+}
+
+func (c *testClientOps) WriteConfig(file string, old, new []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if string(c.config[file]) != string(old) {
+		return sumdb.ErrWriteConflict
+	}
+	c.config[file] = new
+	return nil
+}
+
+func (c *testClientOps) ReadCache(file string) ([]byte, error) {
+	return nil, os.ErrNotExist
+}
+
+func (c *testClientOps) WriteCache(file string, data []byte) {}
+
+func (c *testClientOps) Log(msg string) {}
+
+func (c *testClientOps) SecurityError(msg string) {
+	c.t.Error(msg)
+}
+
+func TestChecksumDBRouterServesVerifiableLookups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.Mkdir(path.Join(dir, "modules"), os.ModePerm))
+	fileStorage, err := storage.NewFileStorage(path.Join(dir, "modules"))
+	require.NoError(t, err)
+
+	logStore, err := storage.NewBoltLogStore(path.Join(dir, "sumdb.db"))
+	require.NoError(t, err)
+	defer logStore.Close()
+
+	skey, vkey, err := note.GenerateKey(rand.Reader, "sum.test.com")
+	require.NoError(t, err)
+	signer, err := note.NewSigner(skey)
+	require.NoError(t, err)
+
+	checksums := services.NewChecksumDBService(fileStorage, logStore, signer, nil, nil)
+
+	router := mux.NewRouter()
+	lhttp.NewChecksumDBRouter(checksums, nil, false).Register(router)
+	lhttp.NewUploadRouter(services.NewUploadService(fileStorage, nil, checksums, nil, nil), nil).Register(router)
+
+	w := serve(router, http.MethodGet, "/_modulesproxy/sumdb/sum.test.com/supported", nil)
+	assert.Equal(t, 200, w.Code)
+
+	client := sumdb.NewClient(&testClientOps{
+		t:      t,
+		router: router,
+		prefix: "/_modulesproxy/sumdb/sum.test.com",
+		config: map[string][]byte{"key": []byte(vkey)},
+	})
+
+	for _, version := range []string{"v1.0.0", "v1.1.0", "v1.2.0"} {
+		source := testModuleZip(t, "test.com/Module", version)
+		w := serve(router, http.MethodPost, "/_modules/test.com/!module/@v/"+version, source)
+		require.Equal(t, 201, w.Code)
+
+		zipFile := path.Join(dir, version+".zip")
+		require.NoError(t, ioutil.WriteFile(zipFile, source, 0600))
+		zipHash, err := dirhash.HashZip(zipFile, dirhash.Hash1)
+		require.NoError(t, err)
+
+		lines, err := client.Lookup("test.com/Module", version)
+		require.NoError(t, err)
+		assert.Contains(t, lines, "test.com/Module "+version+" "+zipHash)
+	}
+
+	_, err = client.Lookup("test.com/Module", "v2.0.0")
+	assert.Error(t, err)
+}
+
+func TestChecksumDBRouterAuthorizesLookups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.Mkdir(path.Join(dir, "modules"), os.ModePerm))
+	fileStorage, err := storage.NewFileStorage(path.Join(dir, "modules"))
+	require.NoError(t, err)
+
+	logStore, err := storage.NewBoltLogStore(path.Join(dir, "sumdb.db"))
+	require.NoError(t, err)
+	defer logStore.Close()
+
+	skey, _, err := note.GenerateKey(rand.Reader, "sum.test.com")
+	require.NoError(t, err)
+	signer, err := note.NewSigner(skey)
+	require.NoError(t, err)
+
+	policy, err := auth.ParsePolicy([]byte("rules:\n  - modules: corp.example/private\n    principals: [\"token:ci\"]\n    action: read\n  - modules: corp.example/public\n    principals: [\"*\"]\n    action: read\n"))
+	require.NoError(t, err)
+
+	checksums := services.NewChecksumDBService(fileStorage, logStore, signer, policy, nil)
+	for _, module := range []string{"corp.example/private", "corp.example/public"} {
+		err = fileStorage.CreateModuleVersion(module, "v1.0.0", ioutil.NopCloser(bytes.NewReader(testModuleZip(t, module, "v1.0.0"))))
+		require.NoError(t, err)
+		require.NoError(t, checksums.Add(module, "v1.0.0"))
+	}
+
+	router := mux.NewRouter()
+	authenticator := auth.NewTokenAuthenticator(map[string]string{"ci": "secret", "other": "secret2"})
+	lhttp.NewChecksumDBRouter(checksums, authenticator, true).Register(router)
+
+	get := func(url, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/_modulesproxy/sumdb/sum.test.com"+url, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, 401, get("/lookup/corp.example/public@v1.0.0", "").Code)
+	assert.Equal(t, 401, get("/tile/8/0/000.p/2", "").Code)
+
+	assert.Equal(t, 200, get("/lookup/corp.example/public@v1.0.0", "secret2").Code)
+	assertErrorResponse(t, get("/lookup/corp.example/private@v1.0.0", "secret2"), 403, "forbidden")
+	assert.Equal(t, 200, get("/lookup/corp.example/private@v1.0.0", "secret").Code)
+}
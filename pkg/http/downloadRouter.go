@@ -5,26 +5,38 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/annymsmthd/go-modules-registry/pkg/auth"
 	"github.com/annymsmthd/go-modules-registry/pkg/services"
 
-	"github.com/coreos/go-semver/semver"
 	"github.com/gorilla/mux"
+	gomodule "golang.org/x/mod/module"
 )
 
 type DownloadRouter struct {
-	service *services.DownloadService
+	service       *services.DownloadService
+	authenticator auth.Authenticator
+	requireAuth   bool
 }
 
-func NewDownloadRouter(service *services.DownloadService) *DownloadRouter {
-	return &DownloadRouter{service}
+// NewDownloadRouter creates a DownloadRouter identifying principals with
+// authenticator, which may be nil to serve everyone anonymously. When
+// requireAuth is set anonymous requests are rejected, otherwise it is up to
+// the service which modules they may read.
+func NewDownloadRouter(service *services.DownloadService, authenticator auth.Authenticator, requireAuth bool) *DownloadRouter {
+	return &DownloadRouter{service, authenticator, requireAuth}
 }
 
 func (d *DownloadRouter) Register(router *mux.Router) {
-	router.Path("/{module:.*}").Queries("go-get", "1").HandlerFunc(d.manifest)
-	router.HandleFunc("/_modulesproxy/{module:.*}/@v/list", d.listHandler)
-	router.HandleFunc("/_modulesproxy/{module:.*}/@v/{version}.info", d.versionInfoHandler)
-	router.HandleFunc("/_modulesproxy/{module:.*}/@v/{version}.mod", d.modHandler)
-	router.HandleFunc("/_modulesproxy/{module:.*}/@v/{version}.zip", d.sourceHandler)
+	router.Path("/{module:.*}").Queries("go-get", "1").HandlerFunc(d.authenticate(d.manifest))
+	router.HandleFunc("/_modulesproxy/{module:.*}/@v/list", d.authenticate(d.listHandler))
+	router.HandleFunc("/_modulesproxy/{module:.*}/@latest", d.authenticate(d.latestHandler))
+	router.HandleFunc("/_modulesproxy/{module:.*}/@v/{version}.info", d.authenticate(d.versionInfoHandler))
+	router.HandleFunc("/_modulesproxy/{module:.*}/@v/{version}.mod", d.authenticate(d.modHandler))
+	router.HandleFunc("/_modulesproxy/{module:.*}/@v/{version}.zip", d.authenticate(d.sourceHandler))
+}
+
+func (d *DownloadRouter) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return authenticate(d.authenticator, d.requireAuth, next)
 }
 
 func (d *DownloadRouter) manifest(w http.ResponseWriter, r *http.Request) {
@@ -40,16 +52,15 @@ func (d *DownloadRouter) manifest(w http.ResponseWriter, r *http.Request) {
 }
 
 func (d *DownloadRouter) listHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	module, ok := vars["module"]
-	if !ok {
-		http.Error(w, "module was not found in vars", 500)
+	module, err := proxyModule(r)
+	if err != nil {
+		respondWithError(w, r, err)
 		return
 	}
 
-	list, err := d.service.ListVersions(module)
+	list, err := d.service.ListVersions(r.Context(), module)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		respondWithError(w, r, err)
 		return
 	}
 
@@ -59,74 +70,140 @@ func (d *DownloadRouter) listHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(response))
 }
 
+func (d *DownloadRouter) latestHandler(w http.ResponseWriter, r *http.Request) {
+	module, err := proxyModule(r)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	versionInfo, err := d.service.Latest(r.Context(), module)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	err = respondWithJSON(w, 200, versionInfo)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+}
+
 func (d *DownloadRouter) versionInfoHandler(w http.ResponseWriter, r *http.Request) {
-	module, version, err := moduleAndVersion(r)
+	module, version, err := proxyModuleAndVersion(r)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		respondWithError(w, r, err)
 		return
 	}
 
-	versionInfo, err := d.service.VersionInfo(module, version)
+	versionInfo, err := d.service.VersionInfo(r.Context(), module, version)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		respondWithError(w, r, err)
 		return
 	}
 
 	err = respondWithJSON(w, 200, versionInfo)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		respondWithError(w, r, err)
 		return
 	}
 }
 
 func (d *DownloadRouter) modHandler(w http.ResponseWriter, r *http.Request) {
-	module, version, err := moduleAndVersion(r)
+	module, version, err := proxyModuleAndVersion(r)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		respondWithError(w, r, err)
 		return
 	}
 
-	reader, modtime, err := d.service.Mod(module, version)
+	reader, modtime, err := d.service.Mod(r.Context(), module, version)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		respondWithError(w, r, err)
 		return
 	}
+	defer reader.Close()
 
-	http.ServeContent(w, r, fmt.Sprintf("v%s.mod", version), *modtime, reader)
+	http.ServeContent(w, r, fmt.Sprintf("%s.mod", version), *modtime, reader)
 }
 
 func (d *DownloadRouter) sourceHandler(w http.ResponseWriter, r *http.Request) {
-	module, version, err := moduleAndVersion(r)
+	module, version, err := proxyModuleAndVersion(r)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		respondWithError(w, r, err)
 		return
 	}
 
-	reader, modtime, err := d.service.Source(module, version)
+	reader, modtime, err := d.service.Source(r.Context(), module, version)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		respondWithError(w, r, err)
 		return
 	}
+	defer reader.Close()
+
+	http.ServeContent(w, r, fmt.Sprintf("%s.zip", version), *modtime, reader)
+}
 
-	http.ServeContent(w, r, fmt.Sprintf("v%s.zip", version), *modtime, reader)
+// proxyModule decodes the module path of a proxy route. The go command only
+// tries the next proxy in GOPROXY after a 404 or 410, so paths this registry
+// can't serve are not found rather than invalid.
+func proxyModule(r *http.Request) (string, error) {
+	module, err := moduleFromVars(r)
+	return module, invalidAsNotFound(err)
+}
+
+// proxyModuleAndVersion decodes the module path and version of a proxy route,
+// reporting non-canonical versions such as branch names as not found.
+func proxyModuleAndVersion(r *http.Request) (string, string, error) {
+	module, version, err := moduleAndVersion(r)
+	return module, version, invalidAsNotFound(err)
 }
 
-func moduleAndVersion(r *http.Request) (string, *semver.Version, error) {
+func invalidAsNotFound(err error) error {
+	if err != nil && services.KindOf(err) == services.KindInvalid {
+		return services.NewErrNotFound("%v", err)
+	}
+	return err
+}
+
+// moduleFromVars decodes the module path from the route, which the go command
+// case-encodes by replacing upper case letters with ! and the lower case letter.
+func moduleFromVars(r *http.Request) (string, error) {
 	vars := mux.Vars(r)
-	module, ok := vars["module"]
+	escaped, ok := vars["module"]
 	if !ok {
-		return "", nil, fmt.Errorf("module was not found in vars")
+		return "", services.NewErrInvalid("module was not found in vars")
 	}
 
-	version, ok := vars["version"]
+	module, err := gomodule.UnescapePath(escaped)
+	if err != nil {
+		return "", services.NewErrInvalid("%v", err)
+	}
+
+	return module, nil
+}
+
+func moduleAndVersion(r *http.Request) (string, string, error) {
+	modulePath, err := moduleFromVars(r)
+	if err != nil {
+		return "", "", err
+	}
+
+	vars := mux.Vars(r)
+	escaped, ok := vars["version"]
 	if !ok {
-		return "", nil, fmt.Errorf("version was not found in vars")
+		return "", "", services.NewErrInvalid("version was not found in vars")
+	}
+
+	version, err := gomodule.UnescapeVersion(escaped)
+	if err != nil {
+		return "", "", services.NewErrInvalid("%v", err)
 	}
 
-	sv, err := semver.NewVersion(version[1:])
+	err = services.CheckVersion(version)
 	if err != nil {
-		return "", nil, err
+		return "", "", services.NewErrInvalid("%v", err)
 	}
 
-	return module, sv, nil
+	return modulePath, version, nil
 }
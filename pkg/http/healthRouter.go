@@ -0,0 +1,52 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/gorilla/mux"
+)
+
+// HealthRouter serves the probes of orchestrators such as Kubernetes and
+// the build of the registry, none of which need authentication.
+type HealthRouter struct {
+	service *services.HealthService
+}
+
+func NewHealthRouter(service *services.HealthService) *HealthRouter {
+	return &HealthRouter{service}
+}
+
+func (h *HealthRouter) Register(router *mux.Router) {
+	router.HandleFunc("/healthz", h.healthz).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/readyz", h.readyz).Methods(http.MethodGet, http.MethodHead)
+	router.HandleFunc("/version", h.version).Methods(http.MethodGet)
+}
+
+// healthz answers as long as the process is serving requests at all.
+func (h *HealthRouter) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok\n"))
+}
+
+func (h *HealthRouter) readyz(w http.ResponseWriter, r *http.Request) {
+	readiness := h.service.Ready(r.Context())
+
+	code := 200
+	if !readiness.Ready {
+		code = 503
+	}
+
+	err := respondWithJSON(w, code, readiness)
+	if err != nil {
+		respondWithError(w, r, err)
+	}
+}
+
+func (h *HealthRouter) version(w http.ResponseWriter, r *http.Request) {
+	err := respondWithJSON(w, 200, h.service.BuildInfo())
+	if err != nil {
+		respondWithError(w, r, err)
+	}
+}
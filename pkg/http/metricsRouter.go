@@ -0,0 +1,23 @@
+package http
+
+import (
+	"github.com/annymsmthd/go-modules-registry/pkg/auth"
+	"github.com/annymsmthd/go-modules-registry/pkg/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// MetricsRouter serves the Prometheus metrics, only to principals
+// authenticator identifies when requireAuth is set.
+type MetricsRouter struct {
+	authenticator auth.Authenticator
+	requireAuth   bool
+}
+
+func NewMetricsRouter(authenticator auth.Authenticator, requireAuth bool) *MetricsRouter {
+	return &MetricsRouter{authenticator, requireAuth}
+}
+
+func (m *MetricsRouter) Register(router *mux.Router) {
+	router.HandleFunc("/metrics", authenticate(m.authenticator, m.requireAuth, metrics.Handler().ServeHTTP))
+}
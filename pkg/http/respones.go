@@ -3,6 +3,11 @@ package http
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/logging"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/pkg/errors"
 )
 
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) error {
@@ -17,3 +22,56 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) error
 
 	return nil
 }
+
+type errorResponse struct {
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Details []string `json:"details,omitempty"`
+}
+
+// detailed is implemented by errors with a list of details, such as every
+// problem found with an upload.
+type detailed interface {
+	Details() []string
+}
+
+const realm = "go-modules-registry"
+
+var errorStatusCodes = map[services.ErrorKind]int{
+	services.KindInvalid:      400,
+	services.KindUnauthorized: 401,
+	services.KindForbidden:    403,
+	services.KindNotFound:     404,
+	services.KindConflict:     409,
+	services.KindGone:         410,
+}
+
+// respondWithError responds with the status code for the kind of the error
+// and a body the client can tell the kind of error from. Internal errors are
+// logged, the client's own mistakes are only in the access log.
+func respondWithError(w http.ResponseWriter, r *http.Request, err error) {
+	kind := services.KindOf(err)
+
+	code, ok := errorStatusCodes[kind]
+	if !ok {
+		code = 500
+		logging.FromContext(r.Context()).WithError(err).WithField("path", r.URL.Path).Error("failed serving request")
+	}
+
+	// tell clients how to authenticate, the go command retries with
+	// credentials from .netrc
+	if kind == services.KindUnauthorized {
+		w.Header().Add("WWW-Authenticate", `Basic realm="`+realm+`"`)
+		w.Header().Add("WWW-Authenticate", `Bearer realm="`+realm+`"`)
+	}
+
+	response := errorResponse{Code: kind.String(), Message: err.Error()}
+	if d, ok := errors.Cause(err).(detailed); ok {
+		response.Details = d.Details()
+	}
+
+	err = respondWithJSON(w, code, response)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+	}
+}
@@ -0,0 +1,423 @@
+package http_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
+	"github.com/annymsmthd/go-modules-registry/pkg/auth"
+	lhttp "github.com/annymsmthd/go-modules-registry/pkg/http"
+	"github.com/annymsmthd/go-modules-registry/pkg/logging"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+	"github.com/annymsmthd/go-modules-registry/pkg/storage"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRouter(t *testing.T) (*mux.Router, func()) {
+	dir, err := ioutil.TempDir("", "storage")
+	require.NoError(t, err)
+
+	fileStorage, err := storage.NewFileStorage(dir)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	lhttp.NewDownloadRouter(services.NewDownloadService(fileStorage, nil, nil, nil, nil, nil), nil, false).Register(router)
+	lhttp.NewAdminRouter(services.NewAdminService(fileStorage, nil, nil), nil).Register(router)
+	lhttp.NewUploadRouter(services.NewUploadService(fileStorage, nil, nil, nil, nil), nil).Register(router)
+
+	return router, func() { os.RemoveAll(dir) }
+}
+
+func testModuleZip(t *testing.T, module, version string) []byte {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	f, err := w.Create(module + "@" + version + "/go.mod")
+	require.NoError(t, err)
+	f.Write([]byte("module " + module + "\n"))
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func serve(router *mux.Router, method, url string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func assertErrorResponse(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	assert.Equal(t, status, w.Code)
+
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, code, body["code"])
+	assert.NotEmpty(t, body["message"])
+}
+
+func TestRoutersMapErrorsToStatusCodes(t *testing.T) {
+	router, cleanup := newTestRouter(t)
+	defer cleanup()
+
+	source := testModuleZip(t, "test.com/Module", "v1.0.0")
+
+	w := serve(router, http.MethodPost, "/_modules/test.com/!module/@v/v1.0.0", source)
+	assert.Equal(t, 201, w.Code)
+
+	w = serve(router, http.MethodPost, "/_modules/test.com/!module/@v/v1.0.0", source)
+	assertErrorResponse(t, w, 409, "conflict")
+
+	w = serve(router, http.MethodPost, "/_modules/test.com/!module/@v/v2.0.0", testModuleZip(t, "test.com/Module", "v2.0.0"))
+	assertErrorResponse(t, w, 400, "invalid")
+
+	w = serve(router, http.MethodPost, "/_modules/test.com/!module/@v/1.0.0", source)
+	assertErrorResponse(t, w, 400, "invalid")
+
+	w = serve(router, http.MethodGet, "/_modulesproxy/test.com/!module/@v/list", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "v1.0.0", w.Body.String())
+
+	w = serve(router, http.MethodGet, "/_modulesproxy/test.com/other/@v/list", nil)
+	assertErrorResponse(t, w, 404, "not_found")
+
+	w = serve(router, http.MethodGet, "/_modulesproxy/test.com/!module/@v/v1.1.0.info", nil)
+	assertErrorResponse(t, w, 404, "not_found")
+
+	w = serve(router, http.MethodGet, "/_modulesproxy/test.com/!module/@v/v1.1.0.zip", nil)
+	assertErrorResponse(t, w, 404, "not_found")
+
+	// the go command asks proxies for branches and moves on after a 404
+	w = serve(router, http.MethodGet, "/_modulesproxy/test.com/!module/@v/master.info", nil)
+	assertErrorResponse(t, w, 404, "not_found")
+
+	w = serve(router, http.MethodGet, "/_modulesproxy/test.com/Module/@v/list", nil)
+	assertErrorResponse(t, w, 404, "not_found")
+}
+
+func TestDownloadRouterClosesServedFiles(t *testing.T) {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("open files can't be counted on this system")
+	}
+
+	router, cleanup := newTestRouter(t)
+	defer cleanup()
+
+	w := serve(router, http.MethodPost, "/_modules/test.com/module/@v/v1.0.0", testModuleZip(t, "test.com/module", "v1.0.0"))
+	require.Equal(t, 201, w.Code)
+
+	open := len(fds)
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/_modulesproxy/test.com/module/@v/v1.0.0.zip", nil)
+		req.Header.Set("Range", "bytes=0-9")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, 206, w.Code)
+
+		w = serve(router, http.MethodHead, "/_modulesproxy/test.com/module/@v/v1.0.0.mod", nil)
+		require.Equal(t, 200, w.Code)
+	}
+
+	fds, err = ioutil.ReadDir("/proc/self/fd")
+	require.NoError(t, err)
+	assert.True(t, len(fds) < open+20, "%d files open after serving versions, %d before", len(fds), open)
+}
+
+func TestAdminRouterRetractsAndDeprecates(t *testing.T) {
+	router, cleanup := newTestRouter(t)
+	defer cleanup()
+
+	for _, version := range []string{"v1.0.0", "v1.1.0"} {
+		w := serve(router, http.MethodPost, "/_modules/test.com/module/@v/"+version, testModuleZip(t, "test.com/module", version))
+		require.Equal(t, 201, w.Code)
+	}
+
+	w := serve(router, http.MethodPut, "/_modules/test.com/module/@v/v1.1.0/retraction", []byte(`{"Reason": "broken build"}`))
+	assert.Equal(t, 204, w.Code)
+
+	w = serve(router, http.MethodPut, "/_modules/test.com/module/@v/v1.2.0/retraction", []byte(`{"Reason": "broken build"}`))
+	assertErrorResponse(t, w, 404, "not_found")
+
+	w = serve(router, http.MethodPut, "/_modules/test.com/module/@deprecation", []byte(`{"Message": "use test.com/module/v2"}`))
+	assert.Equal(t, 204, w.Code)
+
+	w = serve(router, http.MethodGet, "/_modulesproxy/test.com/module/@v/list", nil)
+	assert.Equal(t, "v1.0.0", w.Body.String())
+
+	w = serve(router, http.MethodGet, "/_modulesproxy/test.com/module/@latest", nil)
+	var info api.VersionInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, "v1.0.0", info.Version)
+	assert.Equal(t, "use test.com/module/v2", info.Deprecated)
+
+	w = serve(router, http.MethodGet, "/_modules/test.com/module/@metadata", nil)
+	var metadata api.ModuleMetadata
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &metadata))
+	assert.Equal(t, "broken build", metadata.Retractions["v1.1.0"].Reason)
+
+	w = serve(router, http.MethodDelete, "/_modules/test.com/module/@v/v1.1.0/retraction", nil)
+	assert.Equal(t, 204, w.Code)
+
+	w = serve(router, http.MethodGet, "/_modulesproxy/test.com/module/@v/list", nil)
+	assert.Equal(t, "v1.0.0\nv1.1.0", w.Body.String())
+}
+
+func TestAdminRouterDeletesVersionsForGood(t *testing.T) {
+	router, cleanup := newTestRouter(t)
+	defer cleanup()
+
+	for _, version := range []string{"v1.0.0", "v1.1.0"} {
+		w := serve(router, http.MethodPost, "/_modules/test.com/module/@v/"+version, testModuleZip(t, "test.com/module", version))
+		require.Equal(t, 201, w.Code)
+	}
+
+	w := serve(router, http.MethodDelete, "/_modules/test.com/module/@v/v1.1.0", []byte(`{}`))
+	assertErrorResponse(t, w, 400, "invalid")
+
+	w = serve(router, http.MethodDelete, "/_modules/test.com/module/@v/v1.1.0", []byte(`{"Reason": "leaked secret"}`))
+	assert.Equal(t, 204, w.Code)
+
+	for _, file := range []string{"info", "mod", "zip"} {
+		w = serve(router, http.MethodGet, "/_modulesproxy/test.com/module/@v/v1.1.0."+file, nil)
+		assertErrorResponse(t, w, 410, "gone")
+	}
+
+	w = serve(router, http.MethodGet, "/_modulesproxy/test.com/module/@v/list", nil)
+	assert.Equal(t, "v1.0.0", w.Body.String())
+
+	w = serve(router, http.MethodPost, "/_modules/test.com/module/@v/v1.1.0", testModuleZip(t, "test.com/module", "v1.1.0"))
+	assertErrorResponse(t, w, 410, "gone")
+
+	// deleting again is harmless
+	w = serve(router, http.MethodDelete, "/_modules/test.com/module/@v/v1.1.0", []byte(`{"Reason": "leaked secret"}`))
+	assert.Equal(t, 204, w.Code)
+
+	w = serve(router, http.MethodDelete, "/_modules/test.com/module/@v/v1.2.0", []byte(`{"Reason": "leaked secret"}`))
+	assertErrorResponse(t, w, 404, "not_found")
+}
+
+func TestUploadRouterRequiresAuthentication(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fileStorage, err := storage.NewFileStorage(dir)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	authenticator := auth.NewTokenAuthenticator(map[string]string{"ci": "secret"})
+	lhttp.NewUploadRouter(services.NewUploadService(fileStorage, nil, nil, nil, nil), authenticator).Register(router)
+
+	source := testModuleZip(t, "test.com/module", "v1.0.0")
+
+	w := serve(router, http.MethodPost, "/_modules/test.com/module/@v/v1.0.0", source)
+	assertErrorResponse(t, w, 401, "unauthorized")
+	assert.Contains(t, w.Header()["Www-Authenticate"], `Basic realm="go-modules-registry"`)
+
+	req := httptest.NewRequest(http.MethodPost, "/_modules/test.com/module/@v/v1.0.0", bytes.NewReader(source))
+	req.Header.Set("Authorization", "Bearer wrong")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assertErrorResponse(t, w, 401, "unauthorized")
+
+	req = httptest.NewRequest(http.MethodPost, "/_modules/test.com/module/@v/v1.0.0", bytes.NewReader(source))
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 201, w.Code)
+}
+
+func TestDownloadRouterAuthenticatesReads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fileStorage, err := storage.NewFileStorage(dir)
+	require.NoError(t, err)
+
+	err = fileStorage.CreateModuleVersion("corp.example/private", "v1.0.0", ioutil.NopCloser(bytes.NewReader(testModuleZip(t, "corp.example/private", "v1.0.0"))))
+	require.NoError(t, err)
+	err = fileStorage.CreateModuleVersion("corp.example/public", "v1.0.0", ioutil.NopCloser(bytes.NewReader(testModuleZip(t, "corp.example/public", "v1.0.0"))))
+	require.NoError(t, err)
+
+	policy, err := auth.ParsePolicy([]byte("rules:\n  - modules: corp.example/public\n    principals: [\"*\"]\n    action: read\n  - modules: corp.example\n    principals: [\"token:ci\"]\n    action: read\n"))
+	require.NoError(t, err)
+
+	authenticator := auth.NewTokenAuthenticator(map[string]string{"ci": "secret"})
+	service := services.NewDownloadService(fileStorage, nil, nil, nil, policy, nil)
+
+	get := func(router *mux.Router, url, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// with optional authentication the policy decides what anonymous
+	// requests may read
+	optional := mux.NewRouter()
+	lhttp.NewDownloadRouter(service, authenticator, false).Register(optional)
+
+	w := get(optional, "/_modulesproxy/corp.example/public/@v/list", "")
+	assert.Equal(t, 200, w.Code)
+
+	w = get(optional, "/_modulesproxy/corp.example/private/@v/list", "")
+	assertErrorResponse(t, w, 401, "unauthorized")
+	assert.Contains(t, w.Header()["Www-Authenticate"], `Basic realm="go-modules-registry"`)
+
+	w = get(optional, "/_modulesproxy/corp.example/private/@v/v1.0.0.zip", "secret")
+	assert.Equal(t, 200, w.Code)
+
+	w = get(optional, "/_modulesproxy/corp.example/private/@v/list", "wrong")
+	assertErrorResponse(t, w, 401, "unauthorized")
+
+	// with required authentication nothing is served anonymously
+	required := mux.NewRouter()
+	lhttp.NewDownloadRouter(service, authenticator, true).Register(required)
+
+	w = get(required, "/_modulesproxy/corp.example/public/@v/list", "")
+	assertErrorResponse(t, w, 401, "unauthorized")
+
+	w = get(required, "/corp.example/public?go-get=1", "")
+	assertErrorResponse(t, w, 401, "unauthorized")
+
+	w = get(required, "/corp.example/public?go-get=1", "secret")
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestUploadRouterAuditsPublishesAndDenials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.Mkdir(dir+"/modules", 0755))
+	fileStorage, err := storage.NewFileStorage(dir + "/modules")
+	require.NoError(t, err)
+
+	auditLog, err := storage.NewFileAuditLog(dir + "/audit.log")
+	require.NoError(t, err)
+	defer auditLog.Close()
+
+	router := mux.NewRouter()
+	router.Use(logging.Middleware)
+	authenticator := auth.NewAudited(auth.NewTokenAuthenticator(map[string]string{"ci": "secret", "dev": "secret2"}), auditLog)
+	policy, err := auth.ParsePolicy([]byte("rules:\n  - modules: test.com\n    principals: [\"token:dev\"]\n    action: read\n  - modules: test.com\n    principals: [\"token:ci\"]\n    action: write\n"))
+	require.NoError(t, err)
+	lhttp.NewUploadRouter(services.NewUploadService(fileStorage, nil, nil, policy, auditLog), authenticator).Register(router)
+
+	source := testModuleZip(t, "test.com/module", "v1.0.0")
+
+	for _, token := range []string{"wrong", "", "secret2", "secret"} {
+		req := httptest.NewRequest(http.MethodPost, "/_modules/test.com/module/@v/v1.0.0", bytes.NewReader(source))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.RemoteAddr = "10.0.0.1:4321"
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	contents, err := ioutil.ReadFile(dir + "/audit.log")
+	require.NoError(t, err)
+
+	events := []*services.AuditEvent{}
+	for _, line := range bytes.Split(bytes.TrimSpace(contents), []byte("\n")) {
+		event := &services.AuditEvent{}
+		require.NoError(t, json.Unmarshal(line, event))
+		events = append(events, event)
+	}
+	require.Len(t, events, 4)
+
+	assert.Equal(t, services.AuditAuthFailure, events[0].Action)
+	assert.Equal(t, "unauthorized", events[0].Result)
+	assert.Equal(t, "test.com/module", events[0].Module)
+	assert.Equal(t, "10.0.0.1", events[0].SourceIP)
+	assert.NotEmpty(t, events[0].RequestID)
+
+	// requests without credentials are recorded too
+	assert.Equal(t, services.AuditAuthFailure, events[1].Action)
+	assert.Equal(t, "unauthorized", events[1].Result)
+	assert.Contains(t, events[1].Detail, "authentication required")
+
+	assert.Equal(t, services.AuditDenied, events[2].Action)
+	assert.Equal(t, "forbidden", events[2].Result)
+	assert.Equal(t, "token:dev", events[2].Principal)
+	assert.Equal(t, "test.com/module", events[2].Module)
+
+	assert.Equal(t, services.AuditPublish, events[3].Action)
+	assert.Equal(t, "ok", events[3].Result)
+	assert.Equal(t, "token:ci", events[3].Principal)
+	assert.Equal(t, "test.com/module", events[3].Module)
+	assert.Equal(t, "v1.0.0", events[3].Version)
+	assert.Equal(t, "10.0.0.1", events[3].SourceIP)
+}
+
+func TestHealthRouterReportsReadinessAndBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fileStorage, err := storage.NewFileStorage(dir)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	build := &api.BuildInfo{Version: "v1.2.3", Commit: "abc123", StorageDriver: "file"}
+	lhttp.NewHealthRouter(services.NewHealthService(fileStorage, nil, build)).Register(router)
+
+	w := serve(router, http.MethodGet, "/healthz", nil)
+	assert.Equal(t, 200, w.Code)
+
+	w = serve(router, http.MethodGet, "/version", nil)
+	assert.Equal(t, 200, w.Code)
+	served := &api.BuildInfo{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), served))
+	assert.Equal(t, build, served)
+
+	w = serve(router, http.MethodGet, "/readyz", nil)
+	assert.Equal(t, 200, w.Code)
+	readiness := &api.Readiness{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), readiness))
+	assert.True(t, readiness.Ready)
+	assert.Equal(t, map[string]string{"storage": "ok"}, readiness.Checks)
+
+	// the storage volume going away makes the registry unready but alive
+	require.NoError(t, os.RemoveAll(dir))
+
+	w = serve(router, http.MethodGet, "/readyz", nil)
+	assert.Equal(t, 503, w.Code)
+	readiness = &api.Readiness{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), readiness))
+	assert.False(t, readiness.Ready)
+	assert.Contains(t, readiness.Checks["storage"], "not writable")
+
+	w = serve(router, http.MethodGet, "/healthz", nil)
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestMetricsRouterAuthenticatesWhenRequired(t *testing.T) {
+	authenticator := auth.NewTokenAuthenticator(map[string]string{"ci": "secret"})
+
+	router := mux.NewRouter()
+	lhttp.NewMetricsRouter(authenticator, true).Register(router)
+
+	w := serve(router, http.MethodGet, "/metrics", nil)
+	assertErrorResponse(t, w, 401, "unauthorized")
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "go_goroutines")
+}
@@ -0,0 +1,57 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/auth"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/gorilla/mux"
+)
+
+// SumDBRouter serves the checksum database proxy paths of the GOPROXY
+// protocol.
+type SumDBRouter struct {
+	service       *services.SumDBService
+	authenticator auth.Authenticator
+	requireAuth   bool
+}
+
+// NewSumDBRouter creates a SumDBRouter, only serving principals
+// authenticator identifies when requireAuth is set.
+func NewSumDBRouter(service *services.SumDBService, authenticator auth.Authenticator, requireAuth bool) *SumDBRouter {
+	return &SumDBRouter{service, authenticator, requireAuth}
+}
+
+func (s *SumDBRouter) Register(router *mux.Router) {
+	router.HandleFunc("/_modulesproxy/sumdb/{name}/supported", authenticate(s.authenticator, s.requireAuth, s.supported))
+	router.HandleFunc("/_modulesproxy/sumdb/{name}/{path:.*}", authenticate(s.authenticator, s.requireAuth, s.fetch))
+}
+
+func (s *SumDBRouter) supported(w http.ResponseWriter, r *http.Request) {
+	if !s.service.Supported(mux.Vars(r)["name"]) {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func (s *SumDBRouter) fetch(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	path := vars["path"]
+
+	data, err := s.service.Fetch(vars["name"], path)
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	if strings.HasPrefix(path, "tile/") {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	}
+	w.Write(data)
+}
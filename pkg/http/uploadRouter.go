@@ -3,21 +3,27 @@ package http
 import (
 	"net/http"
 
+	"github.com/annymsmthd/go-modules-registry/pkg/auth"
+	"github.com/annymsmthd/go-modules-registry/pkg/metrics"
 	"github.com/annymsmthd/go-modules-registry/pkg/services"
 
 	"github.com/gorilla/mux"
 )
 
 type UploadRouter struct {
-	service *services.UploadService
+	service       *services.UploadService
+	authenticator auth.Authenticator
 }
 
-func NewUploadRouter(service *services.UploadService) *UploadRouter {
-	return &UploadRouter{service}
+// NewUploadRouter creates an UploadRouter only accepting uploads from
+// principals authenticator identifies, authenticator may be nil to accept
+// anonymous uploads.
+func NewUploadRouter(service *services.UploadService, authenticator auth.Authenticator) *UploadRouter {
+	return &UploadRouter{service, authenticator}
 }
 
 func (r *UploadRouter) Register(router *mux.Router) {
-	router.HandleFunc("/_modules/{module:.*}/@v/{version}", r.upload)
+	router.HandleFunc("/_modules/{module:.*}/@v/{version}", authenticate(r.authenticator, true, r.upload))
 }
 
 func (ur *UploadRouter) upload(w http.ResponseWriter, r *http.Request) {
@@ -28,13 +34,14 @@ func (ur *UploadRouter) upload(w http.ResponseWriter, r *http.Request) {
 
 	module, version, err := moduleAndVersion(r)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		respondWithError(w, r, err)
 		return
 	}
 
-	err = ur.service.CreateModuleVersion(module, version, r.Body)
+	err = ur.service.CreateModuleVersion(r.Context(), module, version, r.Body)
+	metrics.ObserveUpload(err)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		respondWithError(w, r, err)
 		return
 	}
 
@@ -0,0 +1,72 @@
+// Package logging configures the registry's structured logs and carries
+// the request ID and client address of requests through their context.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Configure sets the format, json or logfmt, and the minimum level of the
+// logs written to out.
+func Configure(out io.Writer, format, level string) error {
+	switch format {
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	case "logfmt", "":
+		logrus.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+	default:
+		return fmt.Errorf("unknown log format %s, must be json or logfmt", format)
+	}
+
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logrus.SetLevel(lvl)
+	logrus.SetOutput(out)
+
+	return nil
+}
+
+type requestKey struct{}
+
+type request struct {
+	id       string
+	sourceIP string
+}
+
+// ContextWithRequest returns a copy of ctx carrying the ID of the request
+// and the address of the client that sent it.
+func ContextWithRequest(ctx context.Context, id, sourceIP string) context.Context {
+	return context.WithValue(ctx, requestKey{}, &request{id, sourceIP})
+}
+
+// RequestID returns the ID of the request of ctx, empty outside requests.
+func RequestID(ctx context.Context) string {
+	if r, ok := ctx.Value(requestKey{}).(*request); ok {
+		return r.id
+	}
+	return ""
+}
+
+// SourceIP returns the address of the client of the request of ctx, empty
+// outside requests.
+func SourceIP(ctx context.Context) string {
+	if r, ok := ctx.Value(requestKey{}).(*request); ok {
+		return r.sourceIP
+	}
+	return ""
+}
+
+// FromContext returns a log entry tagged with the request ID of ctx.
+func FromContext(ctx context.Context) *logrus.Entry {
+	entry := logrus.NewEntry(logrus.StandardLogger())
+	if id := RequestID(ctx); id != "" {
+		entry = entry.WithField("request_id", id)
+	}
+	return entry
+}
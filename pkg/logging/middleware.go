@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/response"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader carries the request ID, a client or proxy sending one has
+// it used for the request instead of a new one.
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// Middleware gives every request an ID, returned in the X-Request-ID
+// response header and carried in the request context, and writes an access
+// log entry for it once served.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		sourceIP, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			sourceIP = r.RemoteAddr
+		}
+
+		r = r.WithContext(ContextWithRequest(r.Context(), id, sourceIP))
+
+		recorder := response.NewRecorder(w)
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r)
+
+		fields := logrus.Fields{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      recorder.Code,
+			"bytes":       recorder.Bytes,
+			"duration_ms": time.Since(start).Seconds() * 1000,
+			"source_ip":   sourceIP,
+			"user_agent":  r.UserAgent(),
+		}
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				fields["route"] = template
+			}
+		}
+
+		FromContext(r.Context()).WithFields(fields).Info("request served")
+	})
+}
@@ -0,0 +1,53 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/logging"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareLogsRequestsWithTheirID(t *testing.T) {
+	out := &bytes.Buffer{}
+	require.NoError(t, logging.Configure(out, "json", "info"))
+	defer logging.Configure(os.Stderr, "logfmt", "info")
+
+	var seen string
+	r := mux.NewRouter()
+	r.Use(logging.Middleware)
+	r.HandleFunc("/_modulesproxy/{module:.*}/@v/list", func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+		w.Write([]byte("v1.0.0"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/_modulesproxy/test.com/a/@v/list", nil)
+	req.Header.Set(logging.RequestIDHeader, "from-proxy-1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "from-proxy-1", w.Header().Get(logging.RequestIDHeader))
+	assert.Equal(t, "from-proxy-1", seen)
+
+	entry := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "request served", entry["msg"])
+	assert.Equal(t, "from-proxy-1", entry["request_id"])
+	assert.Equal(t, "/_modulesproxy/{module:.*}/@v/list", entry["route"])
+	assert.Equal(t, float64(200), entry["status"])
+	assert.Equal(t, float64(6), entry["bytes"])
+
+	// ids that could forge log lines are replaced
+	req = httptest.NewRequest(http.MethodGet, "/_modulesproxy/test.com/a/@v/list", nil)
+	req.Header.Set(logging.RequestIDHeader, "bad id\nlevel=error")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.NotEqual(t, "bad id\nlevel=error", seen)
+	assert.Equal(t, seen, w.Header().Get(logging.RequestIDHeader))
+}
@@ -0,0 +1,94 @@
+// Package metrics exposes how the registry is doing to Prometheus.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "registry"
+
+var (
+	// Registry holds every registry metric along with the Go runtime and
+	// process metrics.
+	Registry = prometheus.NewRegistry()
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to serve HTTP requests by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	httpResponseBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "response_bytes_total",
+		Help:      "Bytes served by route.",
+	}, []string{"route"})
+
+	uploads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploads_total",
+		Help:      "Module version uploads by result, which is ok or the kind of error.",
+	}, []string{"result"})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by cache and result, either hit or miss.",
+	}, []string{"cache", "result"})
+
+	storageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "operation_duration_seconds",
+		Help:      "Time taken by storage operations by method and result, which is ok or the kind of error.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		httpResponseBytes,
+		uploads,
+		cacheRequests,
+		storageDuration,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveUpload counts an upload with the result of storing it. Uploads
+// aren't labelled by module, which would leak the paths of private modules
+// and grow with every path requested.
+func ObserveUpload(err error) {
+	uploads.WithLabelValues(result(err)).Inc()
+}
+
+// result labels the outcome of an operation as ok or the kind of its error.
+func result(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return services.KindOf(err).String()
+}
@@ -0,0 +1,66 @@
+package metrics_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/metrics"
+	"github.com/annymsmthd/go-modules-registry/pkg/storage"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T) string {
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, 200, w.Code)
+
+	return w.Body.String()
+}
+
+func TestMiddlewareLabelsRequestsByRoute(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(metrics.Middleware)
+	r.HandleFunc("/_modulesproxy/{module:.*}/@v/list", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1.0.0"))
+	})
+	r.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	})
+
+	for _, url := range []string{"/_modulesproxy/test.com/a/@v/list", "/_modulesproxy/test.com/b/@v/list", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, url, nil))
+	}
+
+	body := scrape(t)
+	assert.Contains(t, body, `registry_http_requests_total{code="200",method="GET",route="/_modulesproxy/{module:.*}/@v/list"} 2`)
+	assert.Contains(t, body, `registry_http_requests_total{code="404",method="GET",route="/"} 1`)
+	assert.Contains(t, body, `registry_http_response_bytes_total{route="/_modulesproxy/{module:.*}/@v/list"} 12`)
+	assert.Contains(t, body, `registry_http_request_duration_seconds_count{method="GET",route="/_modulesproxy/{module:.*}/@v/list"} 2`)
+}
+
+func TestStorageTimesOperations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fileStorage, err := storage.NewFileStorage(dir)
+	require.NoError(t, err)
+
+	s := metrics.NewStorage(fileStorage)
+
+	_, err = s.ModuleVersions("test.com/missing")
+	assert.Error(t, err)
+
+	_, err = s.Modules()
+	assert.NoError(t, err)
+
+	body := scrape(t)
+	assert.Contains(t, body, `registry_storage_operation_duration_seconds_count{method="ModuleVersions",result="not_found"} 1`)
+	assert.Contains(t, body, `registry_storage_operation_duration_seconds_count{method="Modules",result="ok"} 1`)
+}
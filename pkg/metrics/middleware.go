@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/response"
+
+	"github.com/gorilla/mux"
+)
+
+// Middleware records the requests served by a mux.Router, labelled with the
+// template of the route that matched rather than the path so that every
+// module doesn't get its own series.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		recorder := response.NewRecorder(w)
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r)
+
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.Code)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		httpResponseBytes.WithLabelValues(route).Add(float64(recorder.Bytes))
+	})
+}
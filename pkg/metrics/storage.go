@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+)
+
+// Storage times the operations of the Storage it wraps.
+type Storage struct {
+	storage services.Storage
+}
+
+func NewStorage(storage services.Storage) *Storage {
+	return &Storage{storage}
+}
+
+// Ready checks the wrapped storage when it can tell whether it is ready.
+func (s *Storage) Ready(ctx context.Context) error {
+	checker, ok := s.storage.(services.ReadinessChecker)
+	if !ok {
+		return nil
+	}
+	return checker.Ready(ctx)
+}
+
+func observeStorage(method string, start time.Time, err error) {
+	storageDuration.WithLabelValues(method, result(err)).Observe(time.Since(start).Seconds())
+}
+
+func (s *Storage) HasModule(module string) (hasModule bool, err error) {
+	defer func(start time.Time) { observeStorage("HasModule", start, err) }(time.Now())
+	return s.storage.HasModule(module)
+}
+
+func (s *Storage) Modules() (modules []string, err error) {
+	defer func(start time.Time) { observeStorage("Modules", start, err) }(time.Now())
+	return s.storage.Modules()
+}
+
+func (s *Storage) ModuleVersions(module string) (versions []string, err error) {
+	defer func(start time.Time) { observeStorage("ModuleVersions", start, err) }(time.Now())
+	return s.storage.ModuleVersions(module)
+}
+
+func (s *Storage) VersionInfo(module, version string) (info *api.VersionInfo, err error) {
+	defer func(start time.Time) { observeStorage("VersionInfo", start, err) }(time.Now())
+	return s.storage.VersionInfo(module, version)
+}
+
+func (s *Storage) Mod(module, version string) (reader io.ReadSeekCloser, modTime *time.Time, err error) {
+	defer func(start time.Time) { observeStorage("Mod", start, err) }(time.Now())
+	return s.storage.Mod(module, version)
+}
+
+func (s *Storage) Source(module, version string) (reader io.ReadSeekCloser, modTime *time.Time, err error) {
+	defer func(start time.Time) { observeStorage("Source", start, err) }(time.Now())
+	return s.storage.Source(module, version)
+}
+
+func (s *Storage) CreateModuleVersion(module, version string, file io.ReadCloser) (err error) {
+	defer func(start time.Time) { observeStorage("CreateModuleVersion", start, err) }(time.Now())
+	return s.storage.CreateModuleVersion(module, version, file)
+}
+
+func (s *Storage) MirrorModuleVersion(module, version string, info *api.VersionInfo, mod io.Reader, file io.ReadCloser) (err error) {
+	defer func(start time.Time) { observeStorage("MirrorModuleVersion", start, err) }(time.Now())
+	return s.storage.MirrorModuleVersion(module, version, info, mod, file)
+}
+
+func (s *Storage) DeleteModuleVersion(module, version string) (err error) {
+	defer func(start time.Time) { observeStorage("DeleteModuleVersion", start, err) }(time.Now())
+	return s.storage.DeleteModuleVersion(module, version)
+}
+
+func (s *Storage) Metadata(module string) (metadata *api.ModuleMetadata, err error) {
+	defer func(start time.Time) { observeStorage("Metadata", start, err) }(time.Now())
+	return s.storage.Metadata(module)
+}
+
+func (s *Storage) SetMetadata(module string, metadata *api.ModuleMetadata) (err error) {
+	defer func(start time.Time) { observeStorage("SetMetadata", start, err) }(time.Now())
+	return s.storage.SetMetadata(module, metadata)
+}
+
+// Cache counts the hits and misses of the Cache it wraps.
+type Cache struct {
+	name  string
+	cache services.Cache
+}
+
+// NewCache creates a Cache counting lookups in cache under name, such as
+// sumdb.
+func NewCache(name string, cache services.Cache) *Cache {
+	return &Cache{name, cache}
+}
+
+func (c *Cache) Get(key string) ([]byte, error) {
+	data, err := c.cache.Get(key)
+
+	switch {
+	case err == nil:
+		cacheRequests.WithLabelValues(c.name, "hit").Inc()
+	case services.KindOf(err) == services.KindNotFound:
+		cacheRequests.WithLabelValues(c.name, "miss").Inc()
+	}
+
+	return data, err
+}
+
+func (c *Cache) Put(key string, data []byte) error {
+	return c.cache.Put(key, data)
+}
@@ -0,0 +1,28 @@
+// Package response keeps track of the responses written by handlers, for
+// middleware reporting on the requests served.
+package response
+
+import "net/http"
+
+// Recorder keeps the status code and size of a response.
+type Recorder struct {
+	http.ResponseWriter
+	Code  int
+	Bytes int64
+}
+
+// NewRecorder creates a Recorder of the response written to w.
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w, Code: 200}
+}
+
+func (r *Recorder) WriteHeader(code int) {
+	r.Code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *Recorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.Bytes += int64(n)
+	return n, err
+}
@@ -1,50 +1,393 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/annymsmthd/go-modules-registry/pkg/auth"
 	lhttp "github.com/annymsmthd/go-modules-registry/pkg/http"
+	"github.com/annymsmthd/go-modules-registry/pkg/logging"
+	"github.com/annymsmthd/go-modules-registry/pkg/metrics"
 	"github.com/annymsmthd/go-modules-registry/pkg/services"
 	"github.com/annymsmthd/go-modules-registry/pkg/storage"
+	"github.com/annymsmthd/go-modules-registry/pkg/upstream"
 
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/sync/errgroup"
 )
 
 type Server struct {
-	downloadRouter *lhttp.DownloadRouter
-	uploadrouter   *lhttp.UploadRouter
-	settings       *Settings
+	downloadRouter   *lhttp.DownloadRouter
+	sumdbRouter      *lhttp.SumDBRouter
+	uploadrouter     *lhttp.UploadRouter
+	checksumDBRouter *lhttp.ChecksumDBRouter
+	adminRouter      *lhttp.AdminRouter
+	healthRouter     *lhttp.HealthRouter
+	metricsRouter    *lhttp.MetricsRouter
+	index            *storage.BoltIndex
+	tlsConfig        *tls.Config
+	watchers         []io.Closer
+	settings         *Settings
 }
 
 func NewServer(settings *Settings) (*Server, error) {
-	fileStorage, err := storage.NewFileStorage(settings.FileStorageBasePath)
+	backend, err := NewStorage(settings)
 	if err != nil {
 		return nil, err
 	}
+	// only the server recovers file storage, commands may be run next to it
+	if fileStorage, ok := backend.(*storage.FileStorage); ok {
+		err = fileStorage.Recover()
+		if err != nil {
+			return nil, err
+		}
+	}
+	store := metrics.NewStorage(backend)
+
+	var index services.Index
+	var boltIndex *storage.BoltIndex
+	if settings.IndexPath != "" {
+		boltIndex, err = storage.NewBoltIndex(settings.IndexPath)
+		if err != nil {
+			return nil, err
+		}
+		index = boltIndex
+
+		// the server holds the index database's lock, so it has to rebuild
+		// the index itself, before anything can be uploaded
+		if settings.Reindex {
+			count, err := services.NewIndexService(store, index).Reindex()
+			if err != nil {
+				boltIndex.Close()
+				return nil, errors.Wrapf(err, "failed reindexing after %d versions", count)
+			}
+			logrus.WithField("versions", count).Info("reindexed module versions")
+		}
+	}
+
+	upstreams := []*services.UpstreamRule{}
+	for _, u := range settings.Upstreams {
+		upstreams = append(upstreams, &services.UpstreamRule{
+			Pattern:  u.Pattern,
+			Upstream: upstream.NewProxy(u.URL),
+		})
+	}
+
+	// files reloaded when they change, watched until the server stops
+	watchers := []io.Closer{}
+
+	tlsConfig, certWatcher, err := NewTLSConfig(&settings.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if certWatcher != nil {
+		watchers = append(watchers, certWatcher)
+	}
+
+	var auditLog services.AuditLog
+	if settings.AuditLogPath != "" {
+		auditLog, err = storage.NewFileAuditLog(settings.AuditLogPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	authenticator, err := newAuthenticator(settings)
+	if err != nil {
+		return nil, err
+	}
+	if authenticator != nil && auditLog != nil {
+		authenticator = auth.NewAudited(authenticator, auditLog)
+	}
+	if settings.ReadAuth && authenticator == nil {
+		return nil, fmt.Errorf("authenticating downloads needs a tokens, htpasswd or jwt config file or a client ca")
+	}
+
+	var authorizer services.Authorizer
+	if settings.PolicyPath != "" {
+		policy, err := auth.LoadPolicyFile(settings.PolicyPath)
+		if err != nil {
+			return nil, err
+		}
+		authorizer = policy
+		watchers = append(watchers, policy)
+	}
+
+	var checksums *services.ChecksumDBService
+	var checksumDBRouter *lhttp.ChecksumDBRouter
+	if settings.SumDBKeyPath != "" {
+		checksums, err = NewChecksumDBService(settings, store, authorizer, auditLog)
+		if err != nil {
+			return nil, err
+		}
+
+		// tiles hold the hashes of every module, private ones included, so
+		// they can only be served to principals when reads are authorized
+		requireAuth := settings.ReadAuth || authorizer != nil
+		if requireAuth && authenticator == nil {
+			return nil, fmt.Errorf("serving the checksum database with a policy needs a tokens, htpasswd or jwt config file or a client ca")
+		}
+		checksumDBRouter = lhttp.NewChecksumDBRouter(checksums, authenticator, requireAuth)
+	}
+
+	downloadService := services.NewDownloadService(store, index, upstreams, checksums, authorizer, auditLog)
+	downloadRouter := lhttp.NewDownloadRouter(downloadService, authenticator, settings.ReadAuth)
+
+	uploadService := services.NewUploadService(store, index, checksums, authorizer, auditLog)
+	uploadRouter := lhttp.NewUploadRouter(uploadService, authenticator)
+
+	adminService := services.NewAdminService(store, authorizer, auditLog)
+	adminRouter := lhttp.NewAdminRouter(adminService, authenticator)
+
+	sumdbService, err := newSumDBService(settings)
+	if err != nil {
+		return nil, err
+	}
+	sumdbRouter := lhttp.NewSumDBRouter(sumdbService, authenticator, settings.ReadAuth)
+
+	healthService := services.NewHealthService(store, index, NewBuildInfo(settings))
+	healthRouter := lhttp.NewHealthRouter(healthService)
+
+	// metrics on the main port are as open as downloads, the metrics port is
+	// expected to be kept off the network clients use
+	metricsRouter := lhttp.NewMetricsRouter(authenticator, settings.ReadAuth)
+	if settings.MetricsPort != 0 {
+		metricsRouter = lhttp.NewMetricsRouter(nil, false)
+	}
+
+	return &Server{downloadRouter, sumdbRouter, uploadRouter, checksumDBRouter, adminRouter, healthRouter, metricsRouter, boltIndex, tlsConfig, watchers, settings}, nil
+}
+
+// newAuthenticator creates the authenticator for the credentials files in
+// the settings, nil when there are none.
+func newAuthenticator(settings *Settings) (auth.Authenticator, error) {
+	chain := auth.Chain{}
+
+	if settings.TLS.ClientCAPath != "" {
+		chain = append(chain, auth.NewClientCertAuthenticator())
+	}
+
+	if settings.AuthTokensPath != "" {
+		tokens, err := auth.LoadTokenAuthenticator(settings.AuthTokensPath)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, tokens)
+	}
+
+	if settings.AuthHtpasswdPath != "" {
+		basic, err := auth.LoadBasicAuthenticator(settings.AuthHtpasswdPath)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, basic)
+	}
+
+	if settings.AuthJWTPath != "" {
+		jwt, err := auth.LoadJWTAuthenticator(settings.AuthJWTPath)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, jwt)
+	}
+
+	if len(chain) == 0 {
+		return nil, nil
+	}
 
-	downloadService := services.NewDownloadService(fileStorage)
-	downloadRouter := lhttp.NewDownloadRouter(downloadService)
+	return chain, nil
+}
+
+// NewChecksumDBService creates the service keeping the registry's own
+// checksum database, signed with the key at SumDBKeyPath and logged to
+// SumDBLogPath, with lookups authorized by authorizer and denials recorded in auditLog.
+func NewChecksumDBService(settings *Settings, store services.Storage, authorizer services.Authorizer, auditLog services.AuditLog) (*services.ChecksumDBService, error) {
+	if settings.SumDBLogPath == "" {
+		return nil, fmt.Errorf("a checksum log location must be given with a checksum database key")
+	}
+
+	key, err := ioutil.ReadFile(settings.SumDBKeyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading checksum database key")
+	}
+
+	signer, err := note.NewSigner(strings.TrimSpace(string(key)))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid checksum database key")
+	}
+
+	logStore, err := storage.NewBoltLogStore(settings.SumDBLogPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return services.NewChecksumDBService(store, logStore, signer, authorizer, auditLog), nil
+}
+
+func newSumDBService(settings *Settings) (*services.SumDBService, error) {
+	databases := map[string]services.ChecksumDB{}
+	for _, s := range settings.SumDBs {
+		databases[s.Name] = upstream.NewSumDB(s.URL)
+	}
+
+	var cache services.Cache
+	if len(databases) > 0 && settings.SumDBCachePath != "" {
+		fileCache, err := storage.NewFileCache(settings.SumDBCachePath)
+		if err != nil {
+			return nil, err
+		}
+		cache = metrics.NewCache("sumdb", fileCache)
+	}
 
-	uploadService := services.NewUploadService(fileStorage)
-	uploadRouter := lhttp.NewUploadRouter(uploadService)
+	return services.NewSumDBService(databases, cache), nil
+}
 
-	return &Server{downloadRouter, uploadRouter, settings}, nil
+// NewStorage creates the storage backend selected by the settings.
+func NewStorage(settings *Settings) (services.Storage, error) {
+	switch settings.StorageDriver {
+	case "", "file":
+		return storage.NewFileStorage(settings.FileStorageBasePath)
+	case "s3":
+		return storage.NewS3Storage(&settings.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %s", settings.StorageDriver)
+	}
 }
 
-func (s *Server) Run() func() error {
+// Run serves the registry, and its metrics on a port of their own when
+// MetricsPort is set, until ctx is done or a server fails. Once ctx is done
+// in-flight requests are given the shutdown grace period to finish before
+// their connections are closed, then watched files and the index are closed.
+func (s *Server) Run(ctx context.Context) error {
 	r := mux.NewRouter()
+	r.Use(logging.Middleware)
+	r.Use(metrics.Middleware)
+
+	var metricsServer *http.Server
+	if s.settings.MetricsPort != 0 {
+		metricsRouter := mux.NewRouter()
+		s.metricsRouter.Register(metricsRouter)
+		metricsServer = s.newHTTPServer(s.settings.MetricsPort, metricsRouter)
+	} else {
+		s.metricsRouter.Register(r)
+	}
+
+	s.healthRouter.Register(r)
+	if s.checksumDBRouter != nil {
+		s.checksumDBRouter.Register(r)
+	}
+	s.sumdbRouter.Register(r)
 	s.downloadRouter.Register(r)
+	s.adminRouter.Register(r)
 	s.uploadrouter.Register(r)
 
 	r.PathPrefix("/").HandlerFunc(s.handle404)
 
-	return func() error {
-		return http.ListenAndServe(fmt.Sprintf("0.0.0.0:%d", s.settings.Port), r)
+	server := s.newHTTPServer(s.settings.Port, r)
+	server.TLSConfig = s.tlsConfig
+	servers := []*http.Server{server}
+
+	grp, ctx := errgroup.WithContext(ctx)
+
+	logrus.WithFields(logrus.Fields{
+		"port":    s.settings.Port,
+		"tls":     s.tlsConfig != nil,
+		"storage": s.settings.StorageDriver,
+	}).Info("serving registry")
+
+	if metricsServer != nil {
+		logrus.WithField("port", s.settings.MetricsPort).Info("serving metrics")
+		servers = append(servers, metricsServer)
+		grp.Go(func() error {
+			return unlessClosed(errors.Wrap(metricsServer.ListenAndServe(), "failed serving metrics"))
+		})
+	}
+
+	grp.Go(func() error {
+		if s.tlsConfig != nil {
+			// the certificate comes from the tls config
+			return unlessClosed(server.ListenAndServeTLS("", ""))
+		}
+		return unlessClosed(server.ListenAndServe())
+	})
+
+	grp.Go(func() error {
+		<-ctx.Done()
+		return shutdown(servers, s.settings.HTTP.ShutdownGracePeriod)
+	})
+
+	err := grp.Wait()
+
+	for _, watcher := range s.watchers {
+		watcher.Close()
+	}
+
+	if s.index != nil {
+		closeErr := s.index.Close()
+		if closeErr != nil && err == nil {
+			err = errors.Wrap(closeErr, "failed closing index")
+		}
+	}
+
+	return err
+}
+
+// newHTTPServer creates a server listening on port with the timeouts of the
+// settings.
+func (s *Server) newHTTPServer(port int, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf("0.0.0.0:%d", port),
+		Handler:           handler,
+		ReadHeaderTimeout: s.settings.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       s.settings.HTTP.ReadTimeout,
+		WriteTimeout:      s.settings.HTTP.WriteTimeout,
+		IdleTimeout:       s.settings.HTTP.IdleTimeout,
+		MaxHeaderBytes:    s.settings.HTTP.MaxHeaderBytes,
+	}
+}
+
+// unlessClosed returns the error a server stopped serving with, none when it
+// was shut down.
+func unlessClosed(err error) error {
+	if errors.Cause(err) == http.ErrServerClosed {
+		return nil
 	}
+	return err
+}
+
+// shutdown stops servers accepting connections and waits up to gracePeriod
+// for their in-flight requests, closing the connections of the requests that
+// don't finish in time.
+func shutdown(servers []*http.Server, gracePeriod time.Duration) error {
+	logrus.WithField("grace_period", gracePeriod.String()).Info("shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	var firstErr error
+	for _, server := range servers {
+		err := server.Shutdown(ctx)
+		if err != nil {
+			server.Close()
+			if firstErr == nil {
+				firstErr = errors.Wrap(err, "in-flight requests did not finish in time")
+			}
+		}
+	}
+
+	return firstErr
 }
 
 func (s *Server) handle404(w http.ResponseWriter, r *http.Request) {
-	fmt.Printf("url not handled %s\b", r.URL)
+	logging.FromContext(r.Context()).WithField("url", r.URL.String()).Debug("url not handled")
 	w.WriteHeader(404)
 }
@@ -0,0 +1,106 @@
+package server_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/server"
+	"github.com/annymsmthd/go-modules-registry/pkg/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestServerDrainsInFlightUploadsOnShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	port := freePort(t)
+	s, err := server.NewServer(&server.Settings{
+		FileStorageBasePath: dir,
+		IndexPath:           dir + "/index.db",
+		Port:                port,
+		HTTP:                server.HTTPSettings{ShutdownGracePeriod: 5 * time.Second},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- s.Run(ctx) }()
+
+	for i := 0; i < 50; i++ {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	f, err := w.Create("test.com/module@v1.0.0/go.mod")
+	require.NoError(t, err)
+	f.Write([]byte("module test.com/module\n"))
+	require.NoError(t, w.Close())
+	source := buf.Bytes()
+
+	body, bodyWriter := io.Pipe()
+	responses := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/_modules/test.com/module/@v/v1.0.0", port), "application/zip", body)
+		assert.NoError(t, err)
+		responses <- resp
+	}()
+
+	// shut down half way through the upload
+	_, err = bodyWriter.Write(source[:len(source)/2])
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	assert.Error(t, err, "new connections should be refused while draining")
+
+	_, err = bodyWriter.Write(source[len(source)/2:])
+	require.NoError(t, err)
+	require.NoError(t, bodyWriter.Close())
+
+	resp := <-responses
+	require.NotNil(t, resp)
+	resp.Body.Close()
+	assert.Equal(t, 201, resp.StatusCode)
+
+	assert.NoError(t, <-stopped)
+
+	// the index is closed on shutdown, so another process such as reindex
+	// can open it
+	index, err := storage.NewBoltIndex(dir + "/index.db")
+	require.NoError(t, err)
+	defer index.Close()
+
+	hasModule, err := index.HasModule("test.com/module")
+	require.NoError(t, err)
+	assert.True(t, hasModule)
+}
@@ -1,6 +1,72 @@
 package server
 
+import (
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/storage"
+)
+
 type Settings struct {
+	StorageDriver       string
 	FileStorageBasePath string
+	S3                  storage.S3Config
+	IndexPath           string
+	Reindex             bool
+	Upstreams           []UpstreamSettings
+	SumDBs              []SumDBSettings
+	SumDBCachePath      string
+	SumDBKeyPath        string
+	SumDBLogPath        string
+	AuthTokensPath      string
+	AuthHtpasswdPath    string
+	AuthJWTPath         string
+	ReadAuth            bool
+	PolicyPath          string
+	TLS                 TLSSettings
+	HTTP                HTTPSettings
 	Port                int
+	MetricsPort         int
+	AuditLogPath        string
+}
+
+// UpstreamSettings pulls modules matching Pattern, a comma separated list of
+// GOPRIVATE style glob patterns, through from the GOPROXY at URL.
+type UpstreamSettings struct {
+	Pattern string
+	URL     string
+}
+
+// SumDBSettings proxies the checksum database Name, such as sum.golang.org,
+// from URL.
+type SumDBSettings struct {
+	Name string
+	URL  string
+}
+
+// TLSSettings serves HTTPS with the certificate and key at CertPath and
+// KeyPath. Client certificates signed by the CAs at ClientCAPath authenticate
+// requests, and are needed for every request with RequireClientCert.
+// MinVersion is a version such as 1.2 and CipherSuites are the Go names of
+// the suites allowed up to TLS 1.2.
+type TLSSettings struct {
+	CertPath          string
+	KeyPath           string
+	ClientCAPath      string
+	RequireClientCert bool
+	MinVersion        string
+	CipherSuites      []string
+}
+
+// HTTPSettings limits how long the servers wait on clients and how large
+// request headers may be, a zero timeout leaving the limit off and a zero
+// MaxHeaderBytes using Go's default. ShutdownGracePeriod is how long
+// in-flight requests get to finish once the registry is asked to stop, with
+// zero closing their connections right away.
+type HTTPSettings struct {
+	ReadHeaderTimeout   time.Duration
+	ReadTimeout         time.Duration
+	WriteTimeout        time.Duration
+	IdleTimeout         time.Duration
+	MaxHeaderBytes      int
+	ShutdownGracePeriod time.Duration
 }
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/watch"
+
+	"github.com/pkg/errors"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewTLSConfig creates the TLS config for the settings, nil when no
+// certificate is configured. The certificate is reloaded when its files
+// change until the returned watcher is closed.
+func NewTLSConfig(settings *TLSSettings) (*tls.Config, *watch.Watcher, error) {
+	if settings.CertPath == "" && settings.KeyPath == "" {
+		if settings.ClientCAPath != "" {
+			return nil, nil, fmt.Errorf("verifying client certificates needs a tls certificate and key")
+		}
+		return nil, nil, nil
+	}
+	if settings.CertPath == "" || settings.KeyPath == "" {
+		return nil, nil, fmt.Errorf("a tls certificate and key must be given together")
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if settings.MinVersion != "" {
+		version, ok := tlsVersions[settings.MinVersion]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown tls version %s, must be one of 1.0, 1.1, 1.2 or 1.3", settings.MinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	if len(settings.CipherSuites) > 0 {
+		suites, err := parseCipherSuites(settings.CipherSuites)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.CipherSuites = suites
+	}
+
+	if settings.ClientCAPath != "" {
+		pem, err := ioutil.ReadFile(settings.ClientCAPath)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed reading client ca file")
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("no certificates found in client ca file %s", settings.ClientCAPath)
+		}
+		config.ClientCAs = pool
+
+		// clients without a certificate can still authenticate some other
+		// way unless certificates are required
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if settings.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if settings.RequireClientCert {
+		return nil, nil, fmt.Errorf("requiring client certificates needs a client ca file")
+	}
+
+	cert := &certificateFile{certPath: settings.CertPath, keyPath: settings.KeyPath}
+	err := cert.reload()
+	if err != nil {
+		return nil, nil, err
+	}
+	config.GetCertificate = cert.getCertificate
+
+	watcher, err := watch.Files("tls certificate", []string{settings.CertPath, settings.KeyPath}, cert.reload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return config, watcher, nil
+}
+
+// parseCipherSuites parses cipher suite names such as
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. They only apply up to TLS 1.2, the
+// TLS 1.3 suites can't be configured.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	byName := map[string]uint16{}
+	for _, s := range tls.CipherSuites() {
+		byName[s.Name] = s.ID
+	}
+
+	suites := []uint16{}
+	for _, name := range names {
+		id, ok := byName[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure tls cipher suite %s", name)
+		}
+		suites = append(suites, id)
+	}
+
+	return suites, nil
+}
+
+// certificateFile is a certificate and key pair on disk. A pair that fails to
+// reload leaves the last one in place.
+type certificateFile struct {
+	certPath string
+	keyPath  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+}
+
+func (f *certificateFile) reload() error {
+	cert, err := tls.LoadX509KeyPair(f.certPath, f.keyPath)
+	if err != nil {
+		return errors.Wrap(err, "failed loading tls certificate")
+	}
+
+	f.mu.Lock()
+	f.cert = &cert
+	f.mu.Unlock()
+
+	return nil
+}
+
+func (f *certificateFile) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.cert, nil
+}
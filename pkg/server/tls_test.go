@@ -0,0 +1,167 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/auth"
+	"github.com/annymsmthd/go-modules-registry/pkg/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, serial int64, subject pkix.Name, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCert{cert, key, der}
+}
+
+func (c *testCert) write(t *testing.T, certPath, keyPath string) {
+	err := ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0644)
+	require.NoError(t, err)
+
+	if keyPath != "" {
+		der, err := x509.MarshalECPrivateKey(c.key)
+		require.NoError(t, err)
+		err = ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+		require.NoError(t, err)
+	}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestTLSConfigVerifiesClientsAndReloadsCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, 1, pkix.Name{CommonName: "test ca"}, nil)
+	ca.write(t, filepath.Join(dir, "ca.pem"), "")
+
+	serverCert := newTestCert(t, 2, pkix.Name{CommonName: "localhost"}, ca)
+	serverCert.write(t, filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+
+	clientCert := newTestCert(t, 3, pkix.Name{CommonName: "ci", OrganizationalUnit: []string{"platform"}}, ca)
+
+	config, watcher, err := server.NewTLSConfig(&server.TLSSettings{
+		CertPath:     filepath.Join(dir, "cert.pem"),
+		KeyPath:      filepath.Join(dir, "key.pem"),
+		ClientCAPath: filepath.Join(dir, "ca.pem"),
+	})
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	authenticator := auth.NewClientCertAuthenticator()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := authenticator.Authenticate(r)
+		if err != nil || principal == nil {
+			w.Write([]byte("anonymous"))
+			return
+		}
+		w.Write([]byte(principal.Name))
+	}))
+	ts.TLS = config
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	get := func(certs ...tls.Certificate) (string, *x509.Certificate) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs, ServerName: "localhost"},
+		}}
+		resp, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return string(body), resp.TLS.PeerCertificates[0]
+	}
+
+	body, served := get()
+	assert.Equal(t, "anonymous", body)
+	assert.Equal(t, int64(2), served.SerialNumber.Int64())
+
+	body, _ = get(clientCert.tlsCertificate())
+	assert.Equal(t, "cert:ci", body)
+
+	renewed := newTestCert(t, 4, pkix.Name{CommonName: "localhost"}, ca)
+	renewed.write(t, filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+
+	for i := 0; i < 50; i++ {
+		_, served = get()
+		if served.SerialNumber.Int64() == 4 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Equal(t, int64(4), served.SerialNumber.Int64())
+}
+
+func TestNewTLSConfigRejectsBadSettings(t *testing.T) {
+	config, watcher, err := server.NewTLSConfig(&server.TLSSettings{})
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+	assert.Nil(t, watcher)
+
+	for name, settings := range map[string]*server.TLSSettings{
+		"key without cert":         {KeyPath: "key.pem"},
+		"client ca without cert":   {ClientCAPath: "ca.pem"},
+		"unknown version":          {CertPath: "cert.pem", KeyPath: "key.pem", MinVersion: "1.4"},
+		"insecure cipher":          {CertPath: "cert.pem", KeyPath: "key.pem", CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		"required without a ca":    {CertPath: "cert.pem", KeyPath: "key.pem", RequireClientCert: true},
+		"missing certificate file": {CertPath: "missing.pem", KeyPath: "missing.pem"},
+	} {
+		_, _, err := server.NewTLSConfig(settings)
+		assert.Error(t, err, name)
+	}
+}
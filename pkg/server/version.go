@@ -0,0 +1,42 @@
+package server
+
+import (
+	"runtime/debug"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
+)
+
+// Version and Commit describe the build, set with
+// -ldflags "-X github.com/annymsmthd/go-modules-registry/pkg/server.Version=..."
+// and left empty they are read from the build info the go command records.
+var (
+	Version string
+	Commit  string
+)
+
+// NewBuildInfo describes the running build of the registry with the storage
+// driver of settings.
+func NewBuildInfo(settings *Settings) *api.BuildInfo {
+	info := &api.BuildInfo{Version: Version, Commit: Commit, StorageDriver: settings.StorageDriver}
+	if info.StorageDriver == "" {
+		info.StorageDriver = "file"
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if ok {
+		if info.Version == "" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" && info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+
+	return info
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
+)
+
+// AdminService manages what happens to modules after they are published,
+// such as retracting versions and deprecating modules.
+//
+// Retractions and deprecations are the registry's own rather than the go
+// command's retract directives and Deprecated comments: they change what the
+// registry lists and resolves @latest to, but go.mod files are served as
+// published since changing them would break go.sum, so the go command won't
+// warn about them. Publishing a version whose go.mod carries them does that.
+//
+// Metadata changes are only serialized within the process, storage has no
+// conditional writes, so concurrent changes to a module made through
+// different replicas can overwrite one another.
+type AdminService struct {
+	storage    Storage
+	authorizer Authorizer
+	auditLog   AuditLog
+	// serializes read-modify-writes of module metadata in this process
+	mu sync.Mutex
+}
+
+// NewAdminService creates an AdminService, changes need the admin action of
+// authorizer unless it is nil and are recorded in auditLog unless it is nil.
+func NewAdminService(storage Storage, authorizer Authorizer, auditLog AuditLog) *AdminService {
+	return &AdminService{storage: storage, authorizer: authorizer, auditLog: auditLog}
+}
+
+func (s *AdminService) Metadata(ctx context.Context, module string) (*api.ModuleMetadata, error) {
+	err := authorize(s.authorizer, s.auditLog, ctx, ActionRead, module)
+	if err != nil {
+		return nil, err
+	}
+
+	hasModule, err := s.storage.HasModule(module)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasModule {
+		return nil, NewErrModuleDoesntExist(module)
+	}
+
+	return s.storage.Metadata(module)
+}
+
+// Retract marks the version as not to be used, it is left out of version
+// lists and @latest but can still be downloaded by builds that need it.
+func (s *AdminService) Retract(ctx context.Context, module, version, reason string) (err error) {
+	err = authorize(s.authorizer, s.auditLog, ctx, ActionAdmin, module)
+	if err != nil {
+		return err
+	}
+
+	defer func() { audit(s.auditLog, ctx, AuditRetract, module, version, err) }()
+
+	if reason == "" {
+		return NewErrInvalid("a reason must be given for retracting a version")
+	}
+
+	_, err = s.storage.VersionInfo(module, version)
+	if err != nil {
+		return err
+	}
+
+	return s.updateMetadata(module, func(metadata *api.ModuleMetadata) error {
+		if metadata.Retractions == nil {
+			metadata.Retractions = map[string]*api.Retraction{}
+		}
+		metadata.Retractions[version] = &api.Retraction{Reason: reason, By: principalName(ctx), Time: time.Now().UTC()}
+		return nil
+	})
+}
+
+func (s *AdminService) Unretract(ctx context.Context, module, version string) (err error) {
+	err = authorize(s.authorizer, s.auditLog, ctx, ActionAdmin, module)
+	if err != nil {
+		return err
+	}
+
+	defer func() { audit(s.auditLog, ctx, AuditUnretract, module, version, err) }()
+
+	return s.updateMetadata(module, func(metadata *api.ModuleMetadata) error {
+		delete(metadata.Retractions, version)
+		return nil
+	})
+}
+
+// Deprecate marks the module as no longer maintained, message usually says
+// what to use instead.
+func (s *AdminService) Deprecate(ctx context.Context, module, message string) (err error) {
+	err = authorize(s.authorizer, s.auditLog, ctx, ActionAdmin, module)
+	if err != nil {
+		return err
+	}
+
+	defer func() { audit(s.auditLog, ctx, AuditDeprecate, module, "", err) }()
+
+	if message == "" {
+		return NewErrInvalid("a message must be given for deprecating a module")
+	}
+
+	return s.updateMetadata(module, func(metadata *api.ModuleMetadata) error {
+		metadata.Deprecation = &api.Deprecation{Message: message, By: principalName(ctx), Time: time.Now().UTC()}
+		return nil
+	})
+}
+
+func (s *AdminService) Undeprecate(ctx context.Context, module string) (err error) {
+	err = authorize(s.authorizer, s.auditLog, ctx, ActionAdmin, module)
+	if err != nil {
+		return err
+	}
+
+	defer func() { audit(s.auditLog, ctx, AuditUndeprecate, module, "", err) }()
+
+	return s.updateMetadata(module, func(metadata *api.ModuleMetadata) error {
+		metadata.Deprecation = nil
+		return nil
+	})
+}
+
+// Delete removes the version's files from storage for good, such as when
+// they leaked a secret. A tombstone is left in their place so the version
+// is gone for clients and can never be uploaded again.
+func (s *AdminService) Delete(ctx context.Context, module, version, reason string) (err error) {
+	err = authorize(s.authorizer, s.auditLog, ctx, ActionAdmin, module)
+	if err != nil {
+		return err
+	}
+
+	defer func() { audit(s.auditLog, ctx, AuditDelete, module, version, err) }()
+
+	if reason == "" {
+		return NewErrInvalid("a reason must be given for deleting a version")
+	}
+
+	err = s.updateMetadata(module, func(metadata *api.ModuleMetadata) error {
+		if metadata.Deletions[version] != nil {
+			// deleting again retries removing the files
+			return nil
+		}
+
+		_, err := s.storage.VersionInfo(module, version)
+		if err != nil {
+			return err
+		}
+
+		if metadata.Deletions == nil {
+			metadata.Deletions = map[string]*api.Deletion{}
+		}
+		metadata.Deletions[version] = &api.Deletion{Reason: reason, By: principalName(ctx), Time: time.Now().UTC()}
+		delete(metadata.Retractions, version)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the tombstone is written first so the version can't be uploaded again
+	// even when removing its files fails part way. Downloads only look for
+	// tombstones once the files are gone, so deleting again to finish
+	// removing them is what makes the version gone for clients
+	err = s.storage.DeleteModuleVersion(module, version)
+	if KindOf(err) == KindNotFound {
+		return nil
+	}
+
+	return err
+}
+
+func (s *AdminService) updateMetadata(module string, update func(metadata *api.ModuleMetadata) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hasModule, err := s.storage.HasModule(module)
+	if err != nil {
+		return err
+	}
+
+	if !hasModule {
+		return NewErrModuleDoesntExist(module)
+	}
+
+	metadata, err := s.storage.Metadata(module)
+	if err != nil {
+		return err
+	}
+
+	err = update(metadata)
+	if err != nil {
+		return err
+	}
+
+	return s.storage.SetMetadata(module, metadata)
+}
+
+func principalName(ctx context.Context) string {
+	principal := PrincipalFromContext(ctx)
+	if principal == nil {
+		return ""
+	}
+	return principal.Name
+}
+
+// checkNotDeleted returns an ErrVersionDeleted for versions with a
+// tombstone.
+func checkNotDeleted(storage Storage, module, version string) error {
+	metadata, err := storage.Metadata(module)
+	if err != nil {
+		return err
+	}
+
+	if metadata.Deletions[version] != nil {
+		return NewErrVersionDeleted(module, version)
+	}
+
+	return nil
+}
+
+// undeleted returns the versions that haven't been deleted, which an index
+// or upstream can still list.
+func undeleted(versions []string, metadata *api.ModuleMetadata) []string {
+	if len(metadata.Deletions) == 0 {
+		return versions
+	}
+
+	filtered := []string{}
+	for _, v := range versions {
+		if metadata.Deletions[v] == nil {
+			filtered = append(filtered, v)
+		}
+	}
+
+	return filtered
+}
+
+// unretracted returns the versions that haven't been retracted.
+func unretracted(versions []string, metadata *api.ModuleMetadata) []string {
+	if len(metadata.Retractions) == 0 {
+		return versions
+	}
+
+	filtered := []string{}
+	for _, v := range versions {
+		if metadata.Retractions[v] == nil {
+			filtered = append(filtered, v)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,116 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminServiceRetractsVersions(t *testing.T) {
+	storageMock := &MockStorage{
+		moduleVersions: map[string][]string{
+			"test/module": []string{"v1.0.0", "v1.1.0", "v1.2.0-pre"},
+		},
+	}
+
+	admin := services.NewAdminService(storageMock, nil, nil)
+	download := services.NewDownloadService(storageMock, nil, nil, nil, nil, nil)
+	ctx := services.ContextWithPrincipal(context.Background(), &services.Principal{Name: "alice"})
+
+	err := admin.Retract(ctx, "test/module", "v1.1.0", "")
+	assert.Equal(t, services.KindInvalid, services.KindOf(err))
+
+	err = admin.Retract(ctx, "test/module", "v1.3.0", "broken")
+	assert.Error(t, err)
+
+	err = admin.Retract(ctx, "test/module", "v1.1.0", "broken build")
+	require.NoError(t, err)
+
+	versions, err := download.ListVersions(ctx, "test/module")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0", "v1.2.0-pre"}, versions)
+
+	latest, err := download.Latest(ctx, "test/module")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.0.0", latest.Version)
+
+	// retracted versions can still be fetched by builds that depend on them
+	info, err := download.VersionInfo(ctx, "test/module", "v1.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "broken build", info.Retracted)
+
+	metadata, err := admin.Metadata(ctx, "test/module")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", metadata.Retractions["v1.1.0"].By)
+
+	// like the go command, fall back to retracted versions when every
+	// version is retracted
+	require.NoError(t, admin.Retract(ctx, "test/module", "v1.0.0", "broken"))
+	require.NoError(t, admin.Retract(ctx, "test/module", "v1.2.0-pre", "broken"))
+
+	latest, err = download.Latest(ctx, "test/module")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.1.0", latest.Version)
+
+	require.NoError(t, admin.Unretract(ctx, "test/module", "v1.0.0"))
+
+	versions, err = download.ListVersions(ctx, "test/module")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0"}, versions)
+}
+
+func TestAdminServiceDeprecatesModules(t *testing.T) {
+	storageMock := &MockStorage{
+		moduleVersions: map[string][]string{
+			"test/module": []string{"v1.0.0"},
+		},
+	}
+
+	admin := services.NewAdminService(storageMock, nil, nil)
+	download := services.NewDownloadService(storageMock, nil, nil, nil, nil, nil)
+
+	err := admin.Deprecate(context.Background(), "test/other", "use test/module")
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+
+	err = admin.Deprecate(context.Background(), "test/module", "use test/module/v2")
+	require.NoError(t, err)
+
+	info, err := download.Latest(context.Background(), "test/module")
+	require.NoError(t, err)
+	assert.Equal(t, "use test/module/v2", info.Deprecated)
+
+	require.NoError(t, admin.Undeprecate(context.Background(), "test/module"))
+
+	info, err = download.Latest(context.Background(), "test/module")
+	require.NoError(t, err)
+	assert.Empty(t, info.Deprecated)
+}
+
+func TestAdminServiceAuthorizesChanges(t *testing.T) {
+	storageMock := &MockStorage{
+		moduleVersions: map[string][]string{
+			"test/module": []string{"v1.0.0"},
+		},
+	}
+	authorizer := &MockAuthorizer{allowed: map[string]services.Action{
+		"ci":    services.ActionWrite,
+		"alice": services.ActionAdmin,
+	}}
+
+	admin := services.NewAdminService(storageMock, authorizer, nil)
+
+	ci := services.ContextWithPrincipal(context.Background(), &services.Principal{Name: "ci"})
+	err := admin.Retract(ci, "test/module", "v1.0.0", "broken")
+	assert.Equal(t, services.KindForbidden, services.KindOf(err))
+
+	err = admin.Deprecate(context.Background(), "test/module", "unmaintained")
+	assert.Equal(t, services.KindUnauthorized, services.KindOf(err))
+
+	alice := services.ContextWithPrincipal(context.Background(), &services.Principal{Name: "alice"})
+	err = admin.Retract(alice, "test/module", "v1.0.0", "broken")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/logging"
+)
+
+// AuditLog is an append-only record of who changed what in the registry,
+// and of the requests that failed authentication or were denied.
+type AuditLog interface {
+	Record(event *AuditEvent) error
+}
+
+// Audit actions.
+const (
+	AuditPublish     = "publish"
+	AuditDelete      = "delete"
+	AuditRetract     = "retract"
+	AuditUnretract   = "unretract"
+	AuditDeprecate   = "deprecate"
+	AuditUndeprecate = "undeprecate"
+	AuditAuthFailure = "auth_failure"
+	AuditDenied      = "denied"
+)
+
+// AuditEvent is an entry of the audit log. Result is ok or the kind of
+// error the action failed with.
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Result    string    `json:"result"`
+	Principal string    `json:"principal,omitempty"`
+	Module    string    `json:"module,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	SourceIP  string    `json:"source_ip,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+// NewAuditEvent creates the event of action on module@version by the
+// principal of ctx, with the result of err.
+func NewAuditEvent(ctx context.Context, action, module, version string, err error) *AuditEvent {
+	event := &AuditEvent{
+		Time:      time.Now().UTC(),
+		Action:    action,
+		Result:    "ok",
+		Principal: principalName(ctx),
+		Module:    module,
+		Version:   version,
+		SourceIP:  logging.SourceIP(ctx),
+		RequestID: logging.RequestID(ctx),
+	}
+
+	if err != nil {
+		event.Result = KindOf(err).String()
+		event.Detail = err.Error()
+	}
+
+	return event
+}
+
+// audit records action in log unless it is nil. Failing to record doesn't
+// undo the action, so it is only logged.
+func audit(log AuditLog, ctx context.Context, action, module, version string, err error) {
+	if log == nil {
+		return
+	}
+
+	event := NewAuditEvent(ctx, action, module, version, err)
+
+	recordErr := log.Record(event)
+	if recordErr != nil {
+		logging.FromContext(ctx).WithError(recordErr).WithField("action", action).Error("failed recording audit event")
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// Action is something a principal can do with a module.
+type Action int
+
+// Each action includes the ones before it, a principal that may write may
+// also read.
+const (
+	ActionRead Action = iota
+	ActionWrite
+	ActionAdmin
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionRead:
+		return "read"
+	case ActionWrite:
+		return "write"
+	default:
+		return "admin"
+	}
+}
+
+// Authorizer decides which principals may act on which module paths.
+type Authorizer interface {
+	// Allowed reports whether principal, nil for anonymous requests, may
+	// take action on the module path.
+	Allowed(principal *Principal, action Action, modulePath string) bool
+}
+
+// authorize checks that the principal of ctx may take action on the module
+// path, returning an error of KindUnauthorized for anonymous requests and
+// KindForbidden for others when it may not, which is recorded in auditLog
+// unless it is nil. A nil authorizer allows everything the principal's
+// credentials are scoped to. The scope only limits writes, so scoped
+// principals can still read their dependencies.
+func authorize(authorizer Authorizer, auditLog AuditLog, ctx context.Context, action Action, modulePath string) error {
+	err := allowed(authorizer, ctx, action, modulePath)
+	if err != nil {
+		audit(auditLog, ctx, AuditDenied, modulePath, "", err)
+	}
+
+	return err
+}
+
+func allowed(authorizer Authorizer, ctx context.Context, action Action, modulePath string) error {
+	principal := PrincipalFromContext(ctx)
+
+	if principal != nil && principal.Modules != nil && action >= ActionWrite {
+		if !module.MatchPrefixPatterns(strings.Join(principal.Modules, ","), modulePath) {
+			return NewErrForbidden("the credentials of %s are limited to %s", principal.Name, strings.Join(principal.Modules, ", "))
+		}
+	}
+
+	if authorizer == nil || authorizer.Allowed(principal, action, modulePath) {
+		return nil
+	}
+
+	if principal == nil {
+		return NewErrUnauthorized("authentication required to %s %s", action, modulePath)
+	}
+
+	return NewErrForbidden("%s may not %s %s", principal.Name, action, modulePath)
+}
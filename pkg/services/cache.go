@@ -0,0 +1,8 @@
+package services
+
+// Cache keeps data fetched from upstream servers by key, where keys are slash
+// separated paths. Get returns an error of KindNotFound for missing keys.
+type Cache interface {
+	Get(key string) ([]byte, error)
+	Put(key string, data []byte) error
+}
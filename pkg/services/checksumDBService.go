@@ -0,0 +1,227 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// LogStore persists the records of a transparency log along with the hashes
+// of its tree, which are addressed by their tlog stored hash index.
+type LogStore interface {
+	TreeSize() (int64, error)
+	// Lookup returns the id of the record of key, an error of KindNotFound
+	// if there is none.
+	Lookup(key string) (int64, error)
+	ReadRecords(id, n int64) ([][]byte, error)
+	ReadHashes(indexes []int64) ([]tlog.Hash, error)
+	// Append stores the record of key as record id, which must be the tree
+	// size, and hashes from the stored hash index of id onwards.
+	Append(id int64, key string, record []byte, hashes []tlog.Hash) error
+}
+
+// ChecksumDBService keeps a transparency log of the go.sum lines of every
+// module version in storage and serves it as a checksum database signed with
+// signer, implementing sumdb.ServerOps. Lookups need permission to read the
+// module, authorizer may be nil to allow everything. Denied lookups are
+// recorded in auditLog unless it is nil.
+type ChecksumDBService struct {
+	storage    Storage
+	store      LogStore
+	signer     note.Signer
+	authorizer Authorizer
+	auditLog   AuditLog
+	mu         sync.Mutex
+}
+
+func NewChecksumDBService(storage Storage, store LogStore, signer note.Signer, authorizer Authorizer, auditLog AuditLog) *ChecksumDBService {
+	return &ChecksumDBService{storage: storage, store: store, signer: signer, authorizer: authorizer, auditLog: auditLog}
+}
+
+// Name is the name of the checksum database, as used in GOSUMDB.
+func (s *ChecksumDBService) Name() string {
+	return s.signer.Name()
+}
+
+// Add records the hashes of a module version in storage in the log. Versions
+// already in the log keep their record, which is what makes changes to a
+// stored version detectable.
+func (s *ChecksumDBService) Add(module, version string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := module + "@" + version
+
+	_, err := s.store.Lookup(key)
+	if err == nil {
+		return nil
+	}
+	if KindOf(err) != KindNotFound {
+		return err
+	}
+
+	record, err := s.record(module, version)
+	if err != nil {
+		return err
+	}
+
+	id, err := s.store.TreeSize()
+	if err != nil {
+		return err
+	}
+
+	hashes, err := tlog.StoredHashes(id, record, s.hashReader())
+	if err != nil {
+		return errors.Wrapf(err, "failed computing log hashes of %s", key)
+	}
+
+	return s.store.Append(id, key, record, hashes)
+}
+
+// Backfill adds every module version in storage missing from the log,
+// returning the number of versions checked.
+func (s *ChecksumDBService) Backfill() (int, error) {
+	modules, err := s.storage.Modules()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed listing modules")
+	}
+
+	count := 0
+	for _, module := range modules {
+		versions, err := s.storage.ModuleVersions(module)
+		if err != nil {
+			return count, errors.Wrapf(err, "failed listing versions of %s", module)
+		}
+
+		for _, version := range sortVersions(versions) {
+			err = s.Add(module, version)
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// record builds the go.sum lines of a module version in storage.
+func (s *ChecksumDBService) record(module, version string) ([]byte, error) {
+	source, _, err := s.storage.Source(module, version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed getting source of %s@%s", module, version)
+	}
+	defer source.Close()
+
+	// the h1 hash of a zip is computed from its files, which needs the
+	// whole zip on disk
+	tmp, err := ioutil.TempFile("", "source-*.zip")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed creating temporary source file")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	_, err = io.Copy(tmp, source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed copying source of %s@%s", module, version)
+	}
+
+	zipHash, err := dirhash.HashZip(tmp.Name(), dirhash.Hash1)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed hashing source of %s@%s", module, version)
+	}
+
+	mod, _, err := s.storage.Mod(module, version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed getting go.mod of %s@%s", module, version)
+	}
+	defer mod.Close()
+
+	modBytes, err := ioutil.ReadAll(mod)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed reading go.mod of %s@%s", module, version)
+	}
+
+	modHash, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(modBytes)), nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed hashing go.mod of %s@%s", module, version)
+	}
+
+	record := fmt.Sprintf("%s %s %s\n%s %s/go.mod %s\n", module, version, zipHash, module, version, modHash)
+
+	return []byte(record), nil
+}
+
+func (s *ChecksumDBService) hashReader() tlog.HashReader {
+	return tlog.HashReaderFunc(s.store.ReadHashes)
+}
+
+// Signed returns the signed tree head of the log.
+func (s *ChecksumDBService) Signed(ctx context.Context) ([]byte, error) {
+	size, err := s.store.TreeSize()
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := tlog.TreeHash(size, s.hashReader())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed computing tree hash")
+	}
+
+	text := tlog.FormatTree(tlog.Tree{N: size, Hash: hash})
+
+	signed, err := note.Sign(&note.Note{Text: string(text)}, s.signer)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed signing tree head")
+	}
+
+	return signed, nil
+}
+
+func (s *ChecksumDBService) ReadRecords(ctx context.Context, id, n int64) ([][]byte, error) {
+	records, err := s.store.ReadRecords(id, n)
+	return records, notExist(err)
+}
+
+// AuthorizeLookup checks that the principal of ctx may look up the versions
+// of module.
+func (s *ChecksumDBService) AuthorizeLookup(ctx context.Context, module string) error {
+	return authorize(s.authorizer, s.auditLog, ctx, ActionRead, module)
+}
+
+func (s *ChecksumDBService) Lookup(ctx context.Context, m module.Version) (int64, error) {
+	err := s.AuthorizeLookup(ctx, m.Path)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := s.store.Lookup(m.Path + "@" + m.Version)
+	return id, notExist(err)
+}
+
+func (s *ChecksumDBService) ReadTileData(ctx context.Context, t tlog.Tile) ([]byte, error) {
+	data, err := tlog.ReadTileData(t, s.hashReader())
+	return data, notExist(err)
+}
+
+// notExist turns not found errors into os.ErrNotExist, which the sumdb
+// server reports as a 404.
+func notExist(err error) error {
+	if err != nil && KindOf(err) == KindNotFound {
+		return os.ErrNotExist
+	}
+	return err
+}
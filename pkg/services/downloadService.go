@@ -1,24 +1,204 @@
 package services
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"sort"
 	"time"
 
 	"github.com/annymsmthd/go-modules-registry/pkg/api"
+	"github.com/annymsmthd/go-modules-registry/pkg/logging"
 
-	"github.com/coreos/go-semver/semver"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/mod/semver"
+	"golang.org/x/sync/singleflight"
 )
 
 type DownloadService struct {
-	storage Storage
+	storage    Storage
+	index      Index
+	upstreams  []*UpstreamRule
+	checksums  *ChecksumDBService
+	authorizer Authorizer
+	auditLog   AuditLog
+	fetches    singleflight.Group
 }
 
-func NewDownloadService(storage Storage) *DownloadService {
-	return &DownloadService{storage}
+// NewDownloadService creates a DownloadService, index may be nil in which
+// case versions are listed from storage. Modules matching one of the
+// upstream rules are fetched from that upstream when they are missing from
+// storage, and added to checksums unless it is nil. Reads are checked with
+// authorizer unless it is nil, and denied reads recorded in auditLog unless it
+// is nil.
+func NewDownloadService(storage Storage, index Index, upstreams []*UpstreamRule, checksums *ChecksumDBService, authorizer Authorizer, auditLog AuditLog) *DownloadService {
+	return &DownloadService{storage: storage, index: index, upstreams: upstreams, checksums: checksums, authorizer: authorizer, auditLog: auditLog}
 }
 
-func (d *DownloadService) ListVersions(module string) ([]string, error) {
-	hasModule := d.storage.HasModule(module)
+// ListVersions lists the versions of the module that haven't been
+// retracted.
+func (d *DownloadService) ListVersions(ctx context.Context, module string) ([]string, error) {
+	err := authorize(d.authorizer, d.auditLog, ctx, ActionRead, module)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := d.listVersions(ctx, module)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := d.storage.Metadata(module)
+	if err != nil {
+		return nil, err
+	}
+
+	return unretracted(undeleted(versions, metadata), metadata), nil
+}
+
+func (d *DownloadService) listVersions(ctx context.Context, module string) ([]string, error) {
+	versions, err := d.localVersions(module)
+
+	upstream := matchUpstream(d.upstreams, module)
+	if upstream == nil {
+		if err != nil {
+			return nil, err
+		}
+		return sortVersions(versions), nil
+	}
+
+	if err != nil && KindOf(err) != KindNotFound {
+		return nil, err
+	}
+
+	upstreamVersions, upstreamErr := upstream.List(module)
+	if upstreamErr != nil {
+		// still serve what we have when the upstream is unavailable
+		if err != nil {
+			return nil, upstreamErr
+		}
+		logging.FromContext(ctx).WithError(upstreamErr).WithField("module", module).Warn("listing versions without the upstream")
+		return sortVersions(versions), nil
+	}
+
+	return sortVersions(mergeVersions(versions, upstreamVersions)), nil
+}
+
+// Latest returns the version info of the version the go command would
+// resolve @latest to, skipping retracted versions unless every version is
+// retracted.
+func (d *DownloadService) Latest(ctx context.Context, module string) (*api.VersionInfo, error) {
+	err := authorize(d.authorizer, d.auditLog, ctx, ActionRead, module)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := d.listVersions(ctx, module)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := d.storage.Metadata(module)
+	if err != nil {
+		return nil, err
+	}
+
+	versions = undeleted(versions, metadata)
+
+	latest := latestVersion(unretracted(versions, metadata))
+	if latest == "" {
+		latest = latestVersion(versions)
+	}
+	if latest == "" {
+		// modules with only pseudo-versions are not listed by proxies, so
+		// ask the upstream for the version it resolves @latest to
+		upstream := matchUpstream(d.upstreams, module)
+		if upstream == nil {
+			return nil, NewErrModuleDoesntExist(module)
+		}
+
+		info, err := upstream.Latest(module)
+		if err != nil {
+			return nil, err
+		}
+		latest = info.Version
+	}
+
+	return d.VersionInfo(ctx, module, latest)
+}
+
+func (d *DownloadService) VersionInfo(ctx context.Context, module, version string) (*api.VersionInfo, error) {
+	err := authorize(d.authorizer, d.auditLog, ctx, ActionRead, module)
+	if err != nil {
+		return nil, err
+	}
+
+	var info *api.VersionInfo
+	err = d.fromStorage(ctx, module, version, func() (err error) {
+		info, err = d.storage.VersionInfo(module, version)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := d.storage.Metadata(module)
+	if err != nil {
+		return nil, err
+	}
+
+	if retraction := metadata.Retractions[version]; retraction != nil {
+		info.Retracted = retraction.Reason
+	}
+	if metadata.Deprecation != nil {
+		info.Deprecated = metadata.Deprecation.Message
+	}
+
+	return info, nil
+}
+
+func (d *DownloadService) Mod(ctx context.Context, module, version string) (io.ReadSeekCloser, *time.Time, error) {
+	err := authorize(d.authorizer, d.auditLog, ctx, ActionRead, module)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var file io.ReadSeekCloser
+	var modTime *time.Time
+	err = d.fromStorage(ctx, module, version, func() (err error) {
+		file, modTime, err = d.storage.Mod(module, version)
+		return err
+	})
+
+	return file, modTime, err
+}
+
+func (d *DownloadService) Source(ctx context.Context, module, version string) (io.ReadSeekCloser, *time.Time, error) {
+	err := authorize(d.authorizer, d.auditLog, ctx, ActionRead, module)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var file io.ReadSeekCloser
+	var modTime *time.Time
+	err = d.fromStorage(ctx, module, version, func() (err error) {
+		file, modTime, err = d.storage.Source(module, version)
+		return err
+	})
+
+	return file, modTime, err
+}
+
+func (d *DownloadService) localVersions(module string) ([]string, error) {
+	if d.index != nil {
+		return d.listIndexedVersions(module)
+	}
+
+	hasModule, err := d.storage.HasModule(module)
+	if err != nil {
+		return nil, err
+	}
+
 	if !hasModule {
 		return nil, NewErrModuleDoesntExist(module)
 	}
@@ -31,34 +211,136 @@ func (d *DownloadService) ListVersions(module string) ([]string, error) {
 	return versions, nil
 }
 
-func (d *DownloadService) VersionInfo(module string, version *semver.Version) (*api.VersionInfo, error) {
-	hasModule := d.storage.HasModule(module)
+func (d *DownloadService) listIndexedVersions(module string) ([]string, error) {
+	hasModule, err := d.index.HasModule(module)
+	if err != nil {
+		return nil, err
+	}
+
 	if !hasModule {
 		return nil, NewErrModuleDoesntExist(module)
 	}
 
-	info, err := d.storage.VersionInfo(module, version)
+	indexed, err := d.index.ModuleVersions(module)
 	if err != nil {
 		return nil, err
 	}
 
-	return info, nil
+	versions := []string{}
+	for _, v := range indexed {
+		versions = append(versions, v.Version)
+	}
+
+	return versions, nil
 }
 
-func (d *DownloadService) Mod(module string, version *semver.Version) (io.ReadSeeker, *time.Time, error) {
-	hasModule := d.storage.HasModule(module)
-	if !hasModule {
-		return nil, nil, NewErrModuleDoesntExist(module)
+// fromStorage calls read to read a file of a version from storage. When the
+// version isn't in storage it checks the version wasn't deleted, then pulls
+// it through from the module's upstream when there is one and reads again.
+// Tombstones are only looked up for missing versions, since deleting a
+// version removes its files.
+func (d *DownloadService) fromStorage(ctx context.Context, module, version string, read func() error) error {
+	err := read()
+	if KindOf(err) != KindNotFound {
+		return err
+	}
+
+	deletedErr := checkNotDeleted(d.storage, module, version)
+	if deletedErr != nil {
+		return deletedErr
+	}
+
+	upstream := matchUpstream(d.upstreams, module)
+	if upstream == nil {
+		return err
 	}
 
-	return d.storage.Mod(module, version)
+	_, err, _ = d.fetches.Do(module+"@"+version, func() (interface{}, error) {
+		return nil, d.fetch(ctx, upstream, module, version)
+	})
+	if err != nil {
+		return err
+	}
+
+	return read()
 }
 
-func (d *DownloadService) Source(module string, version *semver.Version) (io.ReadSeeker, *time.Time, error) {
-	hasModule := d.storage.HasModule(module)
-	if !hasModule {
-		return nil, nil, NewErrModuleDoesntExist(module)
+func (d *DownloadService) fetch(ctx context.Context, upstream Upstream, module, version string) error {
+	info, err := upstream.VersionInfo(module, version)
+	if err != nil {
+		return err
+	}
+
+	if info.Version != version {
+		return NewErrVersionDoesntExist(module, version)
+	}
+
+	mod, err := upstream.Mod(module, version)
+	if err != nil {
+		return err
+	}
+	defer mod.Close()
+
+	source, err := upstream.Source(module, version)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	// keep the upstream's info and go.mod, which the go command checks
+	// against go.sum and which can differ from what the zip would give
+	err = d.storage.MirrorModuleVersion(module, version, info, mod, source)
+	if KindOf(err) == KindConflict {
+		// another replica stored it first
+		return nil
+	}
+	if err != nil {
+		// an invalid upstream module isn't the client's fault, so don't keep
+		// the kind of the error
+		return fmt.Errorf("failed storing %s@%s from upstream: %v", module, version, err)
+	}
+
+	logging.FromContext(ctx).WithFields(logrus.Fields{"module": module, "version": version}).Info("pulled module version from upstream")
+
+	if d.index != nil {
+		err = indexModuleVersion(d.storage, d.index, module, version)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.checksums != nil {
+		err = d.checksums.Add(module, version)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sortVersions sorts versions in semantic version order.
+func sortVersions(versions []string) []string {
+	sort.Slice(versions, func(i, j int) bool {
+		return semver.Compare(versions[i], versions[j]) < 0
+	})
+
+	return versions
+}
+
+func mergeVersions(versions ...[]string) []string {
+	seen := map[string]bool{}
+	merged := []string{}
+
+	for _, list := range versions {
+		for _, v := range list {
+			if seen[v] {
+				continue
+			}
+			seen[v] = true
+			merged = append(merged, v)
+		}
 	}
 
-	return d.storage.Source(module, version)
+	return merged
 }
@@ -1,8 +1,10 @@
 package services_test
 
 import (
+	"context"
 	"testing"
 
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
 	"github.com/annymsmthd/go-modules-registry/pkg/services"
 
 	"github.com/stretchr/testify/assert"
@@ -15,9 +17,9 @@ func TestDownloadServiceListVersions(t *testing.T) {
 		},
 	}
 
-	service := services.NewDownloadService(storageMock)
+	service := services.NewDownloadService(storageMock, nil, nil, nil, nil, nil)
 
-	versions, err := service.ListVersions("test/module")
+	versions, err := service.ListVersions(context.Background(), "test/module")
 	assert.NoError(t, err)
 
 	assert.ElementsMatch(t, []string{"0.0.1", "0.0.2"}, versions)
@@ -26,9 +28,87 @@ func TestDownloadServiceListVersions(t *testing.T) {
 func TestDownloadServiceListVersionsReturnsModNotFound(t *testing.T) {
 	storageMock := &MockStorage{moduleVersions: map[string][]string{}}
 
-	service := services.NewDownloadService(storageMock)
+	service := services.NewDownloadService(storageMock, nil, nil, nil, nil, nil)
 
-	_, err := service.ListVersions("test/module")
+	_, err := service.ListVersions(context.Background(), "test/module")
 
 	assert.IsType(t, services.NewErrModuleDoesntExist(""), err)
 }
+
+func TestDownloadServiceListVersionsFromIndex(t *testing.T) {
+	storageMock := &MockStorage{moduleVersions: map[string][]string{}}
+	indexMock := &MockIndex{
+		moduleVersions: map[string][]*api.ModuleVersion{
+			"test/module": []*api.ModuleVersion{
+				{Module: "test/module", Version: "v0.0.1"},
+				{Module: "test/module", Version: "v0.0.2"},
+			},
+		},
+	}
+
+	service := services.NewDownloadService(storageMock, indexMock, nil, nil, nil, nil)
+
+	versions, err := service.ListVersions(context.Background(), "test/module")
+	assert.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"v0.0.1", "v0.0.2"}, versions)
+
+	_, err = service.ListVersions(context.Background(), "test/other")
+	assert.IsType(t, services.NewErrModuleDoesntExist(""), err)
+}
+
+func TestDownloadServiceLatest(t *testing.T) {
+	cases := []struct {
+		versions []string
+		latest   string
+	}{
+		{[]string{"v1.0.0", "v1.2.0", "v1.10.0", "v2.0.0-beta.1"}, "v1.10.0"},
+		{[]string{"v1.0.0-rc.1", "v1.0.0-rc.2", "v0.0.0-20181017193950-04a2e542c03f"}, "v1.0.0-rc.2"},
+		{[]string{"v0.0.0-20181017193950-04a2e542c03f", "v0.0.0-20190101000000-abcdefabcdef"}, "v0.0.0-20190101000000-abcdefabcdef"},
+		{[]string{"v1.2.4-0.20181017193950-04a2e542c03f", "v1.2.3"}, "v1.2.3"},
+		{[]string{"v2.0.0+incompatible", "v1.5.0"}, "v1.5.0"},
+		{[]string{"v2.0.0+incompatible", "v3.0.0+incompatible", "v1.0.0-rc.1"}, "v3.0.0+incompatible"},
+	}
+
+	for _, c := range cases {
+		storageMock := &MockStorage{
+			moduleVersions: map[string][]string{"test/module": c.versions},
+		}
+
+		service := services.NewDownloadService(storageMock, nil, nil, nil, nil, nil)
+
+		info, err := service.Latest(context.Background(), "test/module")
+		assert.NoError(t, err)
+		if assert.NotNil(t, info) {
+			assert.Equal(t, c.latest, info.Version)
+		}
+	}
+}
+
+func TestDownloadServiceAuthorizesReads(t *testing.T) {
+	storageMock := &MockStorage{
+		moduleVersions: map[string][]string{
+			"test/module": []string{"v0.0.1"},
+		},
+	}
+	authorizer := &MockAuthorizer{allowed: map[string]services.Action{"alice": services.ActionRead}}
+
+	service := services.NewDownloadService(storageMock, nil, nil, nil, authorizer, nil)
+
+	_, err := service.ListVersions(context.Background(), "test/module")
+	assert.Equal(t, services.KindUnauthorized, services.KindOf(err))
+
+	ctx := services.ContextWithPrincipal(context.Background(), &services.Principal{Name: "bob"})
+	_, err = service.Latest(ctx, "test/module")
+	assert.Equal(t, services.KindForbidden, services.KindOf(err))
+
+	ctx = services.ContextWithPrincipal(context.Background(), &services.Principal{Name: "alice"})
+	info, err := service.VersionInfo(ctx, "test/module", "v0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, "v0.0.1", info.Version)
+
+	// scoped credentials still read their dependencies
+	ctx = services.ContextWithPrincipal(context.Background(), &services.Principal{Name: "alice", Modules: []string{"test/other"}})
+	_, err = service.VersionInfo(ctx, "test/module", "v0.0.1")
+	assert.NoError(t, err)
+}
@@ -2,8 +2,58 @@ package services
 
 import (
 	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorKind classifies errors by what went wrong so they can be reported to
+// clients, such as with an HTTP status code.
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindInvalid
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindGone
+	KindConflict
 )
 
+func (k ErrorKind) String() string {
+	switch k {
+	case KindInvalid:
+		return "invalid"
+	case KindUnauthorized:
+		return "unauthorized"
+	case KindForbidden:
+		return "forbidden"
+	case KindNotFound:
+		return "not_found"
+	case KindGone:
+		return "gone"
+	case KindConflict:
+		return "conflict"
+	default:
+		return "internal"
+	}
+}
+
+type kinded interface {
+	Kind() ErrorKind
+}
+
+// KindOf returns the kind of err, looking through errors wrapped with
+// github.com/pkg/errors. Errors without a kind are internal errors.
+func KindOf(err error) ErrorKind {
+	if k, ok := errors.Cause(err).(kinded); ok {
+		return k.Kind()
+	}
+
+	return KindInternal
+}
+
 type ErrModuleDoesntExist struct {
 	module string
 }
@@ -13,5 +63,209 @@ func NewErrModuleDoesntExist(module string) *ErrModuleDoesntExist {
 }
 
 func (e *ErrModuleDoesntExist) Error() string {
-	return fmt.Sprintf("module %s does not exit", e.module)
+	return fmt.Sprintf("module %s does not exist", e.module)
+}
+
+func (e *ErrModuleDoesntExist) Kind() ErrorKind {
+	return KindNotFound
+}
+
+type ErrVersionDoesntExist struct {
+	module  string
+	version string
+}
+
+func NewErrVersionDoesntExist(module, version string) *ErrVersionDoesntExist {
+	return &ErrVersionDoesntExist{module, version}
+}
+
+func (e *ErrVersionDoesntExist) Error() string {
+	return fmt.Sprintf("version %s of module %s does not exist", e.version, e.module)
+}
+
+func (e *ErrVersionDoesntExist) Kind() ErrorKind {
+	return KindNotFound
+}
+
+type ErrVersionDeleted struct {
+	module  string
+	version string
+}
+
+func NewErrVersionDeleted(module, version string) *ErrVersionDeleted {
+	return &ErrVersionDeleted{module, version}
+}
+
+func (e *ErrVersionDeleted) Error() string {
+	return fmt.Sprintf("version %s of module %s has been deleted", e.version, e.module)
+}
+
+func (e *ErrVersionDeleted) Kind() ErrorKind {
+	return KindGone
+}
+
+type ErrVersionExists struct {
+	module  string
+	version string
+}
+
+func NewErrVersionExists(module, version string) *ErrVersionExists {
+	return &ErrVersionExists{module, version}
+}
+
+func (e *ErrVersionExists) Error() string {
+	return fmt.Sprintf("version %s of module %s already exists", e.version, e.module)
+}
+
+func (e *ErrVersionExists) Kind() ErrorKind {
+	return KindConflict
+}
+
+type ErrInvalidModuleVersion struct {
+	module  string
+	version string
+	reason  string
+}
+
+func NewErrInvalidModuleVersion(module, version, reason string) *ErrInvalidModuleVersion {
+	return &ErrInvalidModuleVersion{module, version, reason}
+}
+
+func (e *ErrInvalidModuleVersion) Error() string {
+	return fmt.Sprintf("invalid module version %s@%s: %s", e.module, e.version, e.reason)
+}
+
+func (e *ErrInvalidModuleVersion) Kind() ErrorKind {
+	return KindInvalid
+}
+
+// ErrInvalidModuleZip is returned for module zips that break the rules of
+// the go command, listing every violation.
+type ErrInvalidModuleZip struct {
+	module     string
+	version    string
+	violations []string
+}
+
+func NewErrInvalidModuleZip(module, version string, violations []string) *ErrInvalidModuleZip {
+	return &ErrInvalidModuleZip{module, version, violations}
+}
+
+func (e *ErrInvalidModuleZip) Error() string {
+	return fmt.Sprintf("invalid module zip for %s@%s:\n%s", e.module, e.version, strings.Join(e.violations, "\n"))
+}
+
+func (e *ErrInvalidModuleZip) Kind() ErrorKind {
+	return KindInvalid
+}
+
+func (e *ErrInvalidModuleZip) Details() []string {
+	return e.violations
+}
+
+// ErrInvalid is returned for requests that are malformed or that break a
+// rule, such as an upload whose go.mod doesn't match its module path.
+type ErrInvalid struct {
+	message string
+}
+
+func NewErrInvalid(format string, args ...interface{}) *ErrInvalid {
+	return &ErrInvalid{fmt.Sprintf(format, args...)}
+}
+
+func (e *ErrInvalid) Error() string {
+	return e.message
+}
+
+func (e *ErrInvalid) Kind() ErrorKind {
+	return KindInvalid
+}
+
+// ErrNotFound is returned when something other than a module or module
+// version doesn't exist.
+type ErrNotFound struct {
+	message string
+}
+
+func NewErrNotFound(format string, args ...interface{}) *ErrNotFound {
+	return &ErrNotFound{fmt.Sprintf(format, args...)}
+}
+
+func (e *ErrNotFound) Error() string {
+	return e.message
+}
+
+func (e *ErrNotFound) Kind() ErrorKind {
+	return KindNotFound
+}
+
+// ErrConflict is returned when a change clashes with another one, such as
+// two different uploads of the same version at once.
+type ErrConflict struct {
+	message string
+}
+
+func NewErrConflict(format string, args ...interface{}) *ErrConflict {
+	return &ErrConflict{fmt.Sprintf(format, args...)}
+}
+
+func (e *ErrConflict) Error() string {
+	return e.message
+}
+
+func (e *ErrConflict) Kind() ErrorKind {
+	return KindConflict
+}
+
+// ErrUnauthorized is returned when a request has no or bad credentials.
+type ErrUnauthorized struct {
+	message string
+}
+
+func NewErrUnauthorized(format string, args ...interface{}) *ErrUnauthorized {
+	return &ErrUnauthorized{fmt.Sprintf(format, args...)}
+}
+
+func (e *ErrUnauthorized) Error() string {
+	return e.message
+}
+
+func (e *ErrUnauthorized) Kind() ErrorKind {
+	return KindUnauthorized
+}
+
+// ErrForbidden is returned when the principal making a request isn't allowed
+// to do it.
+type ErrForbidden struct {
+	message string
+}
+
+func NewErrForbidden(format string, args ...interface{}) *ErrForbidden {
+	return &ErrForbidden{fmt.Sprintf(format, args...)}
+}
+
+func (e *ErrForbidden) Error() string {
+	return e.message
+}
+
+func (e *ErrForbidden) Kind() ErrorKind {
+	return KindForbidden
+}
+
+// ErrGone is returned for things that existed but have been removed for
+// good.
+type ErrGone struct {
+	message string
+}
+
+func NewErrGone(format string, args ...interface{}) *ErrGone {
+	return &ErrGone{fmt.Sprintf(format, args...)}
+}
+
+func (e *ErrGone) Error() string {
+	return e.message
+}
+
+func (e *ErrGone) Kind() ErrorKind {
+	return KindGone
 }
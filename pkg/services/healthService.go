@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
+)
+
+// ReadinessChecker is implemented by storage backends and indexes that can
+// tell whether they are able to serve requests, such as whether the bucket
+// modules are kept in is reachable and writable.
+type ReadinessChecker interface {
+	Ready(ctx context.Context) error
+}
+
+// HealthService reports whether the registry is ready to serve requests and
+// which build of it is running.
+type HealthService struct {
+	checks map[string]ReadinessChecker
+	build  *api.BuildInfo
+}
+
+// NewHealthService creates a HealthService checking storage and index when
+// they implement ReadinessChecker, index may be nil.
+func NewHealthService(storage Storage, index Index, build *api.BuildInfo) *HealthService {
+	checks := map[string]ReadinessChecker{}
+
+	if checker, ok := storage.(ReadinessChecker); ok {
+		checks["storage"] = checker
+	}
+	if checker, ok := index.(ReadinessChecker); ok {
+		checks["index"] = checker
+	}
+
+	return &HealthService{checks, build}
+}
+
+// Ready runs every check, the registry is ready when they all pass.
+func (h *HealthService) Ready(ctx context.Context) *api.Readiness {
+	readiness := &api.Readiness{Ready: true, Checks: map[string]string{}}
+
+	for name, checker := range h.checks {
+		err := checker.Ready(ctx)
+		if err != nil {
+			readiness.Ready = false
+			readiness.Checks[name] = err.Error()
+			continue
+		}
+		readiness.Checks[name] = "ok"
+	}
+
+	return readiness
+}
+
+func (h *HealthService) BuildInfo() *api.BuildInfo {
+	return h.build
+}
@@ -0,0 +1,14 @@
+package services
+
+import "github.com/annymsmthd/go-modules-registry/pkg/api"
+
+// Index is a queryable record of the module versions held in Storage.
+type Index interface {
+	HasModule(module string) (bool, error)
+	Modules() ([]string, error)
+	ModuleVersions(module string) ([]*api.ModuleVersion, error)
+	AddModuleVersion(version *api.ModuleVersion) error
+	// Replace swaps everything indexed for versions at once, leaving the
+	// index as it was when it fails.
+	Replace(versions []*api.ModuleVersion) error
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
+
+	"github.com/pkg/errors"
+)
+
+type IndexService struct {
+	storage Storage
+	index   Index
+}
+
+func NewIndexService(storage Storage, index Index) *IndexService {
+	return &IndexService{storage, index}
+}
+
+// Reindex rebuilds the index from every module version in storage, returning
+// the number of versions read. The index is only replaced once every version
+// has been read, so a failed rebuild leaves it as it was.
+func (s *IndexService) Reindex() (int, error) {
+	modules, err := s.storage.Modules()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed listing modules")
+	}
+
+	indexed := []*api.ModuleVersion{}
+	for _, module := range modules {
+		versions, err := s.storage.ModuleVersions(module)
+		if err != nil {
+			return len(indexed), errors.Wrapf(err, "failed listing versions of %s", module)
+		}
+
+		for _, version := range versions {
+			moduleVersion, err := describeModuleVersion(s.storage, module, version)
+			if err != nil {
+				return len(indexed), err
+			}
+			indexed = append(indexed, moduleVersion)
+		}
+	}
+
+	err = s.index.Replace(indexed)
+	if err != nil {
+		return len(indexed), errors.Wrap(err, "failed replacing index")
+	}
+
+	return len(indexed), nil
+}
+
+// indexModuleVersion reads a module version back out of storage and records
+// it in the index.
+func indexModuleVersion(storage Storage, index Index, module, version string) error {
+	moduleVersion, err := describeModuleVersion(storage, module, version)
+	if err != nil {
+		return err
+	}
+
+	err = index.AddModuleVersion(moduleVersion)
+	if err != nil {
+		return errors.Wrapf(err, "failed indexing %s@%s", module, version)
+	}
+
+	return nil
+}
+
+// describeModuleVersion reads the index entry of a module version out of
+// storage.
+func describeModuleVersion(storage Storage, module, version string) (*api.ModuleVersion, error) {
+	info, err := storage.VersionInfo(module, version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed getting version info of %s@%s", module, version)
+	}
+
+	source, _, err := storage.Source(module, version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed getting source of %s@%s", module, version)
+	}
+	defer source.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed hashing source of %s@%s", module, version)
+	}
+
+	return &api.ModuleVersion{
+		Module:  module,
+		Version: info.Version,
+		Time:    info.Time,
+		Size:    size,
+		SHA256:  hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
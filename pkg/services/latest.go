@@ -0,0 +1,49 @@
+package services
+
+import (
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// latestVersion picks the version the go command would resolve @latest to:
+// the highest release, else the highest +incompatible release, else the
+// highest prerelease, else the highest pseudo-version. It returns an empty
+// string if there are no valid versions.
+func latestVersion(versions []string) string {
+	var release, incompatible, prerelease, pseudo string
+
+	for _, v := range versions {
+		if !semver.IsValid(v) {
+			continue
+		}
+
+		switch {
+		case module.IsPseudoVersion(v):
+			pseudo = maxVersion(pseudo, v)
+		case semver.Prerelease(v) != "":
+			prerelease = maxVersion(prerelease, v)
+		case semver.Build(v) == "+incompatible":
+			incompatible = maxVersion(incompatible, v)
+		default:
+			release = maxVersion(release, v)
+		}
+	}
+
+	switch {
+	case release != "":
+		return release
+	case incompatible != "":
+		return incompatible
+	case prerelease != "":
+		return prerelease
+	default:
+		return pseudo
+	}
+}
+
+func maxVersion(a, b string) string {
+	if a == "" || semver.Compare(b, a) > 0 {
+		return b
+	}
+	return a
+}
@@ -6,16 +6,25 @@ import (
 	"time"
 
 	"github.com/annymsmthd/go-modules-registry/pkg/api"
-	"github.com/coreos/go-semver/semver"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
 )
 
 type MockStorage struct {
 	moduleVersions map[string][]string
+	metadata       map[string]*api.ModuleMetadata
 }
 
-func (s *MockStorage) HasModule(module string) bool {
+func (s *MockStorage) HasModule(module string) (bool, error) {
 	_, ok := s.moduleVersions[module]
-	return ok
+	return ok, nil
+}
+
+func (s *MockStorage) Modules() ([]string, error) {
+	modules := []string{}
+	for module := range s.moduleVersions {
+		modules = append(modules, module)
+	}
+	return modules, nil
 }
 
 func (s *MockStorage) ModuleVersions(module string) ([]string, error) {
@@ -26,18 +35,157 @@ func (s *MockStorage) ModuleVersions(module string) ([]string, error) {
 	return versions, nil
 }
 
-func (s *MockStorage) VersionInfo(module string, version *semver.Version) (*api.VersionInfo, error) {
-	return nil, nil
+func (s *MockStorage) VersionInfo(module, version string) (*api.VersionInfo, error) {
+	for _, existing := range s.moduleVersions[module] {
+		if existing == version {
+			return &api.VersionInfo{Name: version, Short: version, Version: version}, nil
+		}
+	}
+	return nil, fmt.Errorf("doesnt exist")
 }
 
-func (s *MockStorage) Mod(module string, version *semver.Version) (io.ReadSeeker, *time.Time, error) {
+func (s *MockStorage) Mod(module, version string) (io.ReadSeekCloser, *time.Time, error) {
 	return nil, nil, nil
 }
 
-func (s *MockStorage) Source(module string, version *semver.Version) (io.ReadSeeker, *time.Time, error) {
+func (s *MockStorage) Source(module, version string) (io.ReadSeekCloser, *time.Time, error) {
 	return nil, nil, nil
 }
 
-func (s *MockStorage) CreateModuleVersion(module string, version *semver.Version, file io.ReadCloser) error {
+func (s *MockStorage) CreateModuleVersion(module, version string, file io.ReadCloser) error {
+	return nil
+}
+
+func (s *MockStorage) MirrorModuleVersion(module, version string, info *api.VersionInfo, mod io.Reader, file io.ReadCloser) error {
+	return nil
+}
+
+// RecordingStorage is a MockStorage that records the versions created in it.
+type RecordingStorage struct {
+	MockStorage
+	created []string
+}
+
+func (s *RecordingStorage) CreateModuleVersion(module, version string, file io.ReadCloser) error {
+	s.created = append(s.created, module+"@"+version)
+	return nil
+}
+
+func (s *MockStorage) DeleteModuleVersion(module, version string) error {
+	versions := []string{}
+	for _, existing := range s.moduleVersions[module] {
+		if existing != version {
+			versions = append(versions, existing)
+		}
+	}
+	if len(versions) == len(s.moduleVersions[module]) {
+		return services.NewErrVersionDoesntExist(module, version)
+	}
+	s.moduleVersions[module] = versions
+	return nil
+}
+
+func (s *MockStorage) Metadata(module string) (*api.ModuleMetadata, error) {
+	metadata, ok := s.metadata[module]
+	if !ok {
+		return &api.ModuleMetadata{}, nil
+	}
+	return metadata, nil
+}
+
+func (s *MockStorage) SetMetadata(module string, metadata *api.ModuleMetadata) error {
+	if s.metadata == nil {
+		s.metadata = map[string]*api.ModuleMetadata{}
+	}
+	s.metadata[module] = metadata
+	return nil
+}
+
+type MockIndex struct {
+	moduleVersions map[string][]*api.ModuleVersion
+}
+
+func (i *MockIndex) HasModule(module string) (bool, error) {
+	_, ok := i.moduleVersions[module]
+	return ok, nil
+}
+
+func (i *MockIndex) Modules() ([]string, error) {
+	modules := []string{}
+	for module := range i.moduleVersions {
+		modules = append(modules, module)
+	}
+	return modules, nil
+}
+
+func (i *MockIndex) ModuleVersions(module string) ([]*api.ModuleVersion, error) {
+	return i.moduleVersions[module], nil
+}
+
+func (i *MockIndex) AddModuleVersion(version *api.ModuleVersion) error {
+	i.moduleVersions[version.Module] = append(i.moduleVersions[version.Module], version)
+	return nil
+}
+
+func (i *MockIndex) Replace(versions []*api.ModuleVersion) error {
+	i.moduleVersions = map[string][]*api.ModuleVersion{}
+	for _, version := range versions {
+		i.moduleVersions[version.Module] = append(i.moduleVersions[version.Module], version)
+	}
+	return nil
+}
+
+// MockAuthorizer allows the actions in allowed by principal name, with an
+// empty name for anonymous requests.
+type MockAuthorizer struct {
+	allowed map[string]services.Action
+}
+
+func (a *MockAuthorizer) Allowed(principal *services.Principal, action services.Action, modulePath string) bool {
+	name := ""
+	if principal != nil {
+		name = principal.Name
+	}
+
+	granted, ok := a.allowed[name]
+	return ok && granted >= action
+}
+
+// MockChecksumDB serves files by path, counting the requests for each. It
+// fails every request while down.
+type MockChecksumDB struct {
+	files    map[string][]byte
+	requests map[string]int
+	down     bool
+}
+
+func (db *MockChecksumDB) Get(path string) ([]byte, error) {
+	db.requests[path]++
+
+	if db.down {
+		return nil, fmt.Errorf("checksum database unreachable")
+	}
+
+	data, ok := db.files[path]
+	if !ok {
+		return nil, services.NewErrNotFound("not found: unknown module")
+	}
+	return data, nil
+}
+
+type MockCache struct {
+	data map[string][]byte
+}
+
+func (c *MockCache) Get(key string) ([]byte, error) {
+	data, ok := c.data[key]
+	if !ok {
+		return nil, services.NewErrNotFound("%s is not cached", key)
+	}
+	return data, nil
+}
+
+func (c *MockCache) Put(key string, data []byte) error {
+	c.data[key] = data
 	return nil
 }
@@ -0,0 +1,28 @@
+package services
+
+import "context"
+
+// Principal is the authenticated user or machine making a request, along
+// with the groups its credentials put it in. Modules limits the writes of the
+// principal to the module paths matching these GOPRIVATE style patterns,
+// whatever the policy allows, when its credentials are scoped such as CI job
+// tokens.
+type Principal struct {
+	Name    string
+	Groups  []string
+	Modules []string
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying principal.
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal of ctx, nil for anonymous
+// requests.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
@@ -5,14 +5,23 @@ import (
 	"time"
 
 	"github.com/annymsmthd/go-modules-registry/pkg/api"
-	"github.com/coreos/go-semver/semver"
 )
 
+// Storage keeps module versions, with versions given in the canonical module
+// version syntax of the go command such as v1.2.3 or v2.0.0+incompatible.
+// Metadata returns empty metadata for modules that have none.
 type Storage interface {
-	HasModule(module string) bool
+	HasModule(module string) (bool, error)
+	Modules() ([]string, error)
 	ModuleVersions(module string) ([]string, error)
-	VersionInfo(module string, version *semver.Version) (*api.VersionInfo, error)
-	Mod(module string, version *semver.Version) (io.ReadSeeker, *time.Time, error)
-	Source(module string, version *semver.Version) (io.ReadSeeker, *time.Time, error)
-	CreateModuleVersion(module string, version *semver.Version, file io.ReadCloser) error
+	VersionInfo(module, version string) (*api.VersionInfo, error)
+	Mod(module, version string) (io.ReadSeekCloser, *time.Time, error)
+	Source(module, version string) (io.ReadSeekCloser, *time.Time, error)
+	CreateModuleVersion(module, version string, file io.ReadCloser) error
+	// MirrorModuleVersion stores a version pulled from an upstream, keeping
+	// the info and go.mod the upstream serves rather than deriving them.
+	MirrorModuleVersion(module, version string, info *api.VersionInfo, mod io.Reader, file io.ReadCloser) error
+	DeleteModuleVersion(module, version string) error
+	Metadata(module string) (*api.ModuleMetadata, error)
+	SetMetadata(module string, metadata *api.ModuleMetadata) error
 }
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// ChecksumDB fetches files from a checksum database such as sum.golang.org,
+// where path is relative to the database url, for example latest or
+// lookup/golang.org/x/text@v0.3.0.
+type ChecksumDB interface {
+	Get(path string) ([]byte, error)
+}
+
+// SumDBService proxies checksum databases by name as described by the
+// GOPROXY protocol, caching what it fetches.
+type SumDBService struct {
+	databases map[string]ChecksumDB
+	cache     Cache
+}
+
+// NewSumDBService creates a SumDBService proxying databases by name. The
+// cache may be nil to fetch everything from the databases.
+func NewSumDBService(databases map[string]ChecksumDB, cache Cache) *SumDBService {
+	return &SumDBService{databases, cache}
+}
+
+func (s *SumDBService) Supported(name string) bool {
+	_, ok := s.databases[name]
+	return ok
+}
+
+// Fetch returns a file of the checksum database with name. Lookups and tiles
+// never change once published so they are served from the cache, the latest
+// signed tree head is always fetched and only served from the cache when the
+// database can't be reached.
+func (s *SumDBService) Fetch(name, path string) ([]byte, error) {
+	db, ok := s.databases[name]
+	if !ok {
+		return nil, NewErrNotFound("checksum database %s is not proxied", name)
+	}
+
+	err := checkSumDBPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := name + "/" + path
+
+	if s.cache != nil && path != "latest" {
+		data, err := s.cache.Get(key)
+		if err == nil {
+			return data, nil
+		}
+		if KindOf(err) != KindNotFound {
+			return nil, err
+		}
+	}
+
+	data, err := db.Get(path)
+	if err != nil {
+		if s.cache != nil && path == "latest" && KindOf(err) != KindNotFound {
+			if cached, cacheErr := s.cache.Get(key); cacheErr == nil {
+				return cached, nil
+			}
+		}
+		return nil, err
+	}
+
+	if s.cache != nil {
+		// a failure to cache shouldn't fail the request, the file is fetched
+		// again next time
+		s.cache.Put(key, data)
+	}
+
+	return data, nil
+}
+
+// checkSumDBPath only lets through the paths a checksum database serves, so
+// nothing else is forwarded or used as a cache key.
+func checkSumDBPath(path string) error {
+	switch {
+	case path == "latest":
+		return nil
+	case strings.HasPrefix(path, "lookup/"):
+		modVersion := strings.TrimPrefix(path, "lookup/")
+		i := strings.LastIndex(modVersion, "@")
+		if i < 0 {
+			return NewErrInvalid("checksum database lookup %s must be module@version", modVersion)
+		}
+		modulePath, err := module.UnescapePath(modVersion[:i])
+		if err != nil {
+			return NewErrInvalid("invalid module path in checksum database lookup: %s", err)
+		}
+		version, err := module.UnescapeVersion(modVersion[i+1:])
+		if err != nil {
+			return NewErrInvalid("invalid version in checksum database lookup: %s", err)
+		}
+		err = module.Check(modulePath, version)
+		if err != nil {
+			return NewErrInvalid("invalid checksum database lookup: %s", err)
+		}
+		return nil
+	case strings.HasPrefix(path, "tile/"):
+		_, err := tlog.ParseTilePath(path)
+		if err != nil {
+			return NewErrInvalid("invalid checksum database tile %s", path)
+		}
+		return nil
+	default:
+		return NewErrNotFound("checksum database path %s does not exist", path)
+	}
+}
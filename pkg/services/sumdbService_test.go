@@ -0,0 +1,83 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockChecksumDB() *MockChecksumDB {
+	return &MockChecksumDB{
+		files: map[string][]byte{
+			"latest":                         []byte("sum.test\n1\n"),
+			"lookup/test.com/!module@v1.0.0": []byte("1\ntest.com/Module v1.0.0 h1:abc=\n"),
+			"tile/8/0/000":                   {1, 2, 3},
+		},
+		requests: map[string]int{},
+	}
+}
+
+func TestSumDBServiceCachesLookupsAndTiles(t *testing.T) {
+	db := newMockChecksumDB()
+	service := services.NewSumDBService(map[string]services.ChecksumDB{"sum.test": db}, &MockCache{data: map[string][]byte{}})
+
+	assert.True(t, service.Supported("sum.test"))
+	assert.False(t, service.Supported("sum.golang.org"))
+
+	for i := 0; i < 2; i++ {
+		lookup, err := service.Fetch("sum.test", "lookup/test.com/!module@v1.0.0")
+		require.NoError(t, err)
+		assert.Equal(t, "1\ntest.com/Module v1.0.0 h1:abc=\n", string(lookup))
+
+		tile, err := service.Fetch("sum.test", "tile/8/0/000")
+		require.NoError(t, err)
+		assert.Equal(t, []byte{1, 2, 3}, tile)
+	}
+
+	assert.Equal(t, 1, db.requests["lookup/test.com/!module@v1.0.0"])
+	assert.Equal(t, 1, db.requests["tile/8/0/000"])
+}
+
+func TestSumDBServiceFetchesLatest(t *testing.T) {
+	db := newMockChecksumDB()
+	service := services.NewSumDBService(map[string]services.ChecksumDB{"sum.test": db}, &MockCache{data: map[string][]byte{}})
+
+	latest, err := service.Fetch("sum.test", "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "sum.test\n1\n", string(latest))
+
+	db.files["latest"] = []byte("sum.test\n2\n")
+	latest, err = service.Fetch("sum.test", "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "sum.test\n2\n", string(latest))
+
+	// the last tree head is served when the database is unreachable
+	db.down = true
+	latest, err = service.Fetch("sum.test", "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "sum.test\n2\n", string(latest))
+}
+
+func TestSumDBServiceRejectsUnknownPaths(t *testing.T) {
+	db := newMockChecksumDB()
+	service := services.NewSumDBService(map[string]services.ChecksumDB{"sum.test": db}, &MockCache{data: map[string][]byte{}})
+
+	_, err := service.Fetch("sum.golang.org", "latest")
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+
+	_, err = service.Fetch("sum.test", "lookup/test.com/other@v1.0.0")
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+
+	_, err = service.Fetch("sum.test", "lookup/../../etc/passwd")
+	assert.Equal(t, services.KindInvalid, services.KindOf(err))
+
+	_, err = service.Fetch("sum.test", "tile/../../etc/passwd")
+	assert.Equal(t, services.KindInvalid, services.KindOf(err))
+
+	_, err = service.Fetch("sum.test", "other")
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+	assert.Equal(t, map[string]int{"lookup/test.com/other@v1.0.0": 1}, db.requests)
+}
@@ -1,19 +1,71 @@
 package services
 
 import (
+	"context"
 	"io"
 
-	"github.com/coreos/go-semver/semver"
+	"github.com/annymsmthd/go-modules-registry/pkg/logging"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 type UploadService struct {
-	storage Storage
+	storage    Storage
+	index      Index
+	checksums  *ChecksumDBService
+	authorizer Authorizer
+	auditLog   AuditLog
 }
 
-func NewUploadService(storage Storage) *UploadService {
-	return &UploadService{storage}
+// NewUploadService creates an UploadService, index may be nil when module
+// versions aren't being indexed and checksums may be nil when the registry
+// doesn't keep its own checksum database. Uploads are checked with
+// authorizer unless it is nil, and recorded in auditLog unless it is nil.
+func NewUploadService(storage Storage, index Index, checksums *ChecksumDBService, authorizer Authorizer, auditLog AuditLog) *UploadService {
+	return &UploadService{storage, index, checksums, authorizer, auditLog}
 }
 
-func (s *UploadService) CreateModuleVersion(module string, version *semver.Version, file io.ReadCloser) error {
-	return s.storage.CreateModuleVersion(module, version, file)
+func (s *UploadService) CreateModuleVersion(ctx context.Context, module, version string, file io.ReadCloser) (err error) {
+	err = authorize(s.authorizer, s.auditLog, ctx, ActionWrite, module)
+	if err != nil {
+		return err
+	}
+
+	defer func() { audit(s.auditLog, ctx, AuditPublish, module, version, err) }()
+
+	err = CheckModuleVersion(module, version)
+	if err != nil {
+		return err
+	}
+
+	// builds that checked the deleted version's sum must never get different
+	// content for it
+	err = checkNotDeleted(s.storage, module, version)
+	if err != nil {
+		return err
+	}
+
+	err = s.storage.CreateModuleVersion(module, version, file)
+	if err != nil {
+		return err
+	}
+
+	logging.FromContext(ctx).WithFields(logrus.Fields{"module": module, "version": version}).Info("published module version")
+
+	if s.index != nil {
+		err = indexModuleVersion(s.storage, s.index, module, version)
+		if err != nil {
+			return errors.Wrap(err, "version was stored but not indexed, run reindex")
+		}
+	}
+
+	if s.checksums != nil {
+		err = s.checksums.Add(module, version)
+		if err != nil {
+			return errors.Wrap(err, "version was stored but not added to the checksum database, run sumdb backfill")
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,44 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadServiceAuthorizesWrites(t *testing.T) {
+	storageMock := &RecordingStorage{}
+	authorizer := &MockAuthorizer{allowed: map[string]services.Action{
+		"":      services.ActionRead,
+		"alice": services.ActionRead,
+		"ci":    services.ActionWrite,
+	}}
+
+	service := services.NewUploadService(storageMock, nil, nil, authorizer, nil)
+
+	upload := func(principal *services.Principal) error {
+		ctx := context.Background()
+		if principal != nil {
+			ctx = services.ContextWithPrincipal(ctx, principal)
+		}
+		return service.CreateModuleVersion(ctx, "test.com/module", "v1.0.0", ioutil.NopCloser(&bytes.Buffer{}))
+	}
+
+	err := upload(nil)
+	assert.Equal(t, services.KindUnauthorized, services.KindOf(err))
+
+	err = upload(&services.Principal{Name: "alice"})
+	assert.Equal(t, services.KindForbidden, services.KindOf(err))
+
+	err = upload(&services.Principal{Name: "ci", Modules: []string{"test.com/other"}})
+	assert.Equal(t, services.KindForbidden, services.KindOf(err))
+
+	err = upload(&services.Principal{Name: "ci"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test.com/module@v1.0.0"}, storageMock.created)
+}
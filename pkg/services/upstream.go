@@ -0,0 +1,38 @@
+package services
+
+import (
+	"io"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
+
+	"golang.org/x/mod/module"
+)
+
+// Upstream is a GOPROXY that module versions missing from Storage are
+// fetched from.
+type Upstream interface {
+	List(module string) ([]string, error)
+	Latest(module string) (*api.VersionInfo, error)
+	VersionInfo(module, version string) (*api.VersionInfo, error)
+	Mod(module, version string) (io.ReadCloser, error)
+	Source(module, version string) (io.ReadCloser, error)
+}
+
+// UpstreamRule fetches modules whose path matches Pattern, a comma separated
+// list of GOPRIVATE style glob patterns, from Upstream.
+type UpstreamRule struct {
+	Pattern  string
+	Upstream Upstream
+}
+
+// matchUpstream returns the upstream of the first rule matching the module,
+// or nil when the module isn't proxied.
+func matchUpstream(rules []*UpstreamRule, modulePath string) Upstream {
+	for _, rule := range rules {
+		if module.MatchPrefixPatterns(rule.Pattern, modulePath) {
+			return rule.Upstream
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"fmt"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// CheckVersion checks that version is a canonical module version the go
+// command could request, such as v1.2.3, v1.2.3-pre.1,
+// v0.0.0-20181017193950-04a2e542c03f or v2.0.0+incompatible.
+func CheckVersion(version string) error {
+	if !semver.IsValid(version) {
+		return fmt.Errorf("%s is not a valid module version", version)
+	}
+
+	canonical := semver.Canonical(version)
+	if semver.Build(version) == "+incompatible" {
+		canonical += "+incompatible"
+	}
+
+	if version != canonical {
+		return fmt.Errorf("%s is not a canonical module version, use %s", version, canonical)
+	}
+
+	return nil
+}
+
+// CheckModuleVersion checks that version can be published under the module
+// path the way the go command expects: the major version must match the
+// path's /vN suffix, or .vN for gopkg.in paths, and +incompatible is only
+// used for v2 and above of paths without a suffix.
+func CheckModuleVersion(modulePath, version string) error {
+	err := CheckVersion(version)
+	if err != nil {
+		return NewErrInvalidModuleVersion(modulePath, version, err.Error())
+	}
+
+	_, pathMajor, ok := module.SplitPathVersion(modulePath)
+	if !ok {
+		return NewErrInvalidModuleVersion(modulePath, version, "malformed module path")
+	}
+
+	major := semver.Major(version)
+
+	err = module.Check(modulePath, version)
+	if err != nil {
+		reason := err.Error()
+		if moduleErr, ok := err.(*module.ModuleError); ok {
+			reason = moduleErr.Err.Error()
+			if versionErr, ok := moduleErr.Err.(*module.InvalidVersionError); ok {
+				reason = versionErr.Err.Error()
+			}
+		}
+
+		if major != "v0" && major != "v1" && pathMajor == "" {
+			reason += fmt.Sprintf("; %s versions must be published under a module path ending in /%s (or .%s for gopkg.in), or as %s+incompatible for code without a go.mod", major, major, major, version)
+		}
+
+		return NewErrInvalidModuleVersion(modulePath, version, reason)
+	}
+
+	if semver.Build(version) == "+incompatible" {
+		if pathMajor != "" {
+			return NewErrInvalidModuleVersion(modulePath, version, fmt.Sprintf("+incompatible can't be used with the major version suffix %s", pathMajor))
+		}
+
+		if major == "v0" || major == "v1" {
+			return NewErrInvalidModuleVersion(modulePath, version, fmt.Sprintf("+incompatible is only used for v2 and above, not %s", major))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckVersion(t *testing.T) {
+	for _, v := range []string{
+		"v1.2.3",
+		"v1.2.3-pre.1",
+		"v0.0.0-20181017193950-04a2e542c03f",
+		"v1.2.4-0.20181017193950-04a2e542c03f",
+		"v2.0.0+incompatible",
+	} {
+		assert.NoError(t, services.CheckVersion(v), v)
+	}
+
+	for _, v := range []string{
+		"1.2.3",
+		"v1.2",
+		"v1.2.3+build",
+		"latest",
+	} {
+		assert.Error(t, services.CheckVersion(v), v)
+	}
+}
+
+func TestCheckModuleVersion(t *testing.T) {
+	valid := [][2]string{
+		{"example.com/mod", "v1.2.3"},
+		{"example.com/mod", "v0.0.0-20181017193950-04a2e542c03f"},
+		{"example.com/mod", "v2.0.0+incompatible"},
+		{"example.com/mod/v2", "v2.1.0"},
+		{"example.com/mod/v3", "v3.0.0-pre"},
+		{"gopkg.in/yaml.v2", "v2.2.1"},
+	}
+	for _, c := range valid {
+		assert.NoError(t, services.CheckModuleVersion(c[0], c[1]), c)
+	}
+
+	invalid := [][2]string{
+		{"example.com/mod", "v2.0.0"},
+		{"example.com/mod/v2", "v1.0.0"},
+		{"example.com/mod/v2", "v3.0.0"},
+		{"example.com/mod/v2", "v2.0.0+incompatible"},
+		{"example.com/mod", "v1.0.0+incompatible"},
+		{"gopkg.in/yaml.v2", "v3.0.0"},
+		{"example.com/mod", "1.0.0"},
+	}
+	for _, c := range invalid {
+		err := services.CheckModuleVersion(c[0], c[1])
+		assert.IsType(t, services.NewErrInvalidModuleVersion("", "", ""), err, c)
+	}
+
+	err := services.CheckModuleVersion("example.com/mod", "v2.0.0")
+	assert.EqualError(t, err, "invalid module version example.com/mod@v2.0.0: should be v0 or v1, not v2; v2 versions must be published under a module path ending in /v2 (or .v2 for gopkg.in), or as v2.0.0+incompatible for code without a go.mod")
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// blobStore keeps files by the hex SHA-256 of their contents at
+// {dir}/{first two hex digits}/{hash}, so identical files are only stored
+// once and can be checked against their name.
+type blobStore struct {
+	dir string
+}
+
+func newBlobStore(dir string) (*blobStore, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed creating blobs directory")
+	}
+
+	return &blobStore{dir}, nil
+}
+
+func isBlobHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(hash)
+	return err == nil && strings.ToLower(hash) == hash
+}
+
+func (b *blobStore) path(hash string) (string, error) {
+	if !isBlobHash(hash) {
+		return "", fmt.Errorf("invalid blob hash %q", hash)
+	}
+
+	return path.Join(b.dir, hash[:2], hash), nil
+}
+
+// lock takes the lock of the blob store, which holds across every process
+// sharing the storage. Blobs are put holding it shared until a version
+// references them, and removed holding it exclusively, so blobs can't be
+// removed from under a version being published.
+func (b *blobStore) lock(exclusive bool) (func(), error) {
+	return lockFile(path.Join(b.dir, ".lock"), exclusive)
+}
+
+// put stores the contents of file, leaving file in place, and returns their
+// hash. It must be called holding the lock shared.
+func (b *blobStore) put(file string) (string, error) {
+	hash, err := hashFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	blob, err := b.path(hash)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(path.Dir(blob), os.ModePerm)
+	if err != nil {
+		return "", errors.Wrap(err, "failed creating blob directory")
+	}
+
+	if fileExists(blob) {
+		return hash, nil
+	}
+
+	// link the file in when it's on the same file system, otherwise copy
+	// it. Either way the blob appears under its name in one step.
+	err = os.Link(file, blob)
+	if os.IsExist(err) {
+		return hash, nil
+	}
+	if err != nil {
+		err = b.copyIn(file, blob)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = syncFile(blob)
+	if err != nil {
+		return "", errors.Wrap(err, "failed syncing blob")
+	}
+
+	err = syncFile(path.Dir(blob))
+	if err != nil {
+		return "", errors.Wrap(err, "failed syncing blob directory")
+	}
+
+	return hash, nil
+}
+
+func (b *blobStore) copyIn(file, blob string) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return errors.Wrap(err, "failed opening file to store")
+	}
+	defer src.Close()
+
+	tmp, err := ioutil.TempFile(path.Dir(blob), ".tmp-")
+	if err != nil {
+		return errors.Wrap(err, "failed creating blob")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	_, err = io.Copy(tmp, src)
+	if err != nil {
+		return errors.Wrap(err, "failed copying blob")
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return errors.Wrap(err, "failed closing blob")
+	}
+
+	err = os.Rename(tmp.Name(), blob)
+	if err != nil {
+		return errors.Wrap(err, "failed moving blob")
+	}
+
+	return nil
+}
+
+func (b *blobStore) open(hash string) (*os.File, error) {
+	blob, err := b.path(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(blob)
+}
+
+// verify checks the blob's contents still hash to its name.
+func (b *blobStore) verify(hash string) error {
+	blob, err := b.path(hash)
+	if err != nil {
+		return err
+	}
+
+	actual, err := hashFile(blob)
+	if err != nil {
+		return err
+	}
+
+	if actual != hash {
+		return fmt.Errorf("blob %s is corrupt, its contents hash to %s", hash, actual)
+	}
+
+	return nil
+}
+
+// walk calls fn with the hash and file info of every blob.
+func (b *blobStore) walk(fn func(hash string, info os.FileInfo) error) error {
+	return filepath.Walk(b.dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || !isBlobHash(info.Name()) {
+			return nil
+		}
+
+		return fn(info.Name(), info)
+	})
+}
+
+// remove removes the blob of hash. It must be called holding the lock
+// exclusively.
+func (b *blobStore) remove(hash string) error {
+	blob, err := b.path(hash)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(blob)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed removing blob %s", hash)
+	}
+
+	return nil
+}
+
+// collect removes the blobs not in referenced, along with copies left behind
+// by crashes, returning how many blobs were removed. It must be called
+// holding the lock exclusively.
+func (b *blobStore) collect(referenced map[string]bool) (int, error) {
+	removed := 0
+
+	err := filepath.Walk(b.dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		if strings.HasPrefix(info.Name(), ".tmp-") {
+			return os.Remove(file)
+		}
+
+		if !isBlobHash(info.Name()) || referenced[info.Name()] {
+			return nil
+		}
+
+		err = os.Remove(file)
+		if err != nil {
+			return err
+		}
+		removed++
+
+		return nil
+	})
+	if err != nil {
+		return removed, errors.Wrap(err, "failed collecting blobs")
+	}
+
+	return removed, nil
+}
+
+func hashFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", errors.Wrap(err, "failed opening file to hash")
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", errors.Wrap(err, "failed hashing file")
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
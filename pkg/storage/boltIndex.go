@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var modulesBucket = []byte("modules")
+
+// BoltIndex is an Index kept in an embedded bolt database, with a bucket per
+// module holding the metadata of each version keyed by version.
+type BoltIndex struct {
+	db *bolt.DB
+}
+
+func NewBoltIndex(file string) (*BoltIndex, error) {
+	// bolt locks the database file, time out rather than block forever when
+	// another process such as a running server holds it
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err == bolt.ErrTimeout {
+		return nil, errors.Wrap(err, "index database is in use by another process such as a running server")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed opening index database")
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(modulesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "failed creating modules bucket")
+	}
+
+	return &BoltIndex{db}, nil
+}
+
+func (i *BoltIndex) Close() error {
+	return i.db.Close()
+}
+
+// Ready checks that the index database is open and has its modules bucket.
+func (i *BoltIndex) Ready(ctx context.Context) error {
+	return i.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(modulesBucket) == nil {
+			return errors.New("index has no modules bucket")
+		}
+		return nil
+	})
+}
+
+func (i *BoltIndex) HasModule(module string) (bool, error) {
+	hasModule := false
+
+	err := i.db.View(func(tx *bolt.Tx) error {
+		hasModule = tx.Bucket(modulesBucket).Bucket([]byte(module)) != nil
+		return nil
+	})
+
+	return hasModule, err
+}
+
+func (i *BoltIndex) Modules() ([]string, error) {
+	modules := []string{}
+
+	err := i.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(modulesBucket).ForEach(func(k, v []byte) error {
+			modules = append(modules, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed listing indexed modules")
+	}
+
+	return modules, nil
+}
+
+func (i *BoltIndex) ModuleVersions(module string) ([]*api.ModuleVersion, error) {
+	versions := []*api.ModuleVersion{}
+
+	err := i.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(modulesBucket).Bucket([]byte(module))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var version api.ModuleVersion
+			err := json.Unmarshal(v, &version)
+			if err != nil {
+				return errors.Wrapf(err, "failed unmarshalling %s@%s", module, k)
+			}
+
+			versions = append(versions, &version)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed listing indexed versions")
+	}
+
+	return versions, nil
+}
+
+func (i *BoltIndex) AddModuleVersion(version *api.ModuleVersion) error {
+	return i.db.Update(func(tx *bolt.Tx) error {
+		return putModuleVersion(tx.Bucket(modulesBucket), version)
+	})
+}
+
+// Replace builds a fresh modules bucket from versions and swaps it in within
+// one transaction, so readers see either the old index or the new one.
+func (i *BoltIndex) Replace(versions []*api.ModuleVersion) error {
+	return i.db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket(modulesBucket)
+		if err != nil {
+			return err
+		}
+
+		modules, err := tx.CreateBucket(modulesBucket)
+		if err != nil {
+			return err
+		}
+
+		for _, version := range versions {
+			err = putModuleVersion(modules, version)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func putModuleVersion(modules *bolt.Bucket, version *api.ModuleVersion) error {
+	data, err := json.Marshal(version)
+	if err != nil {
+		return errors.Wrap(err, "failed marshalling module version")
+	}
+
+	bucket, err := modules.CreateBucketIfNotExists([]byte(version.Module))
+	if err != nil {
+		return errors.Wrap(err, "failed creating module bucket")
+	}
+
+	return bucket.Put([]byte(version.Version), data)
+}
@@ -0,0 +1,87 @@
+package storage_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
+	"github.com/annymsmthd/go-modules-registry/pkg/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBoltIndex(t *testing.T) (*storage.BoltIndex, func()) {
+	dir, err := ioutil.TempDir("", "index")
+	require.NoError(t, err)
+
+	index, err := storage.NewBoltIndex(path.Join(dir, "index.db"))
+	require.NoError(t, err)
+
+	return index, func() {
+		index.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBoltIndexAddAndListModuleVersions(t *testing.T) {
+	index, cleanup := newTestBoltIndex(t)
+	defer cleanup()
+
+	uploaded := time.Date(2018, 10, 17, 0, 0, 0, 0, time.UTC)
+
+	for _, version := range []string{"v1.0.0", "v1.1.0"} {
+		err := index.AddModuleVersion(&api.ModuleVersion{
+			Module:  "test.com/module",
+			Version: version,
+			Time:    uploaded,
+			Size:    10,
+			SHA256:  "abc",
+		})
+		require.NoError(t, err)
+	}
+
+	hasModule, err := index.HasModule("test.com/module")
+	require.NoError(t, err)
+	assert.True(t, hasModule)
+
+	hasModule, err = index.HasModule("test.com/other")
+	require.NoError(t, err)
+	assert.False(t, hasModule)
+
+	modules, err := index.Modules()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test.com/module"}, modules)
+
+	versions, err := index.ModuleVersions("test.com/module")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, "v1.0.0", versions[0].Version)
+	assert.Equal(t, "v1.1.0", versions[1].Version)
+	assert.Equal(t, uploaded, versions[0].Time)
+	assert.Equal(t, int64(10), versions[0].Size)
+	assert.Equal(t, "abc", versions[0].SHA256)
+}
+
+func TestBoltIndexReplace(t *testing.T) {
+	index, cleanup := newTestBoltIndex(t)
+	defer cleanup()
+
+	err := index.AddModuleVersion(&api.ModuleVersion{Module: "test.com/module", Version: "v1.0.0"})
+	require.NoError(t, err)
+
+	err = index.Replace([]*api.ModuleVersion{{Module: "test.com/other", Version: "v2.0.0"}})
+	require.NoError(t, err)
+
+	modules, err := index.Modules()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test.com/other"}, modules)
+
+	versions, err := index.ModuleVersions("test.com/other")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, "v2.0.0", versions[0].Version)
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+var (
+	recordsBucket = []byte("records")
+	lookupsBucket = []byte("lookups")
+	hashesBucket  = []byte("hashes")
+)
+
+// BoltLogStore is a LogStore kept in an embedded bolt database, with records
+// and hashes keyed by their big endian id and index and a bucket mapping
+// module@version to record id.
+type BoltLogStore struct {
+	db *bolt.DB
+}
+
+func NewBoltLogStore(file string) (*BoltLogStore, error) {
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed opening checksum log database")
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{recordsBucket, lookupsBucket, hashesBucket} {
+			_, err := tx.CreateBucketIfNotExists(bucket)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "failed creating checksum log buckets")
+	}
+
+	return &BoltLogStore{db}, nil
+}
+
+func (l *BoltLogStore) Close() error {
+	return l.db.Close()
+}
+
+func (l *BoltLogStore) TreeSize() (int64, error) {
+	var size int64
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		size = treeSize(tx)
+		return nil
+	})
+
+	return size, err
+}
+
+// treeSize is one past the id of the last record, ids are contiguous.
+func treeSize(tx *bolt.Tx) int64 {
+	k, _ := tx.Bucket(recordsBucket).Cursor().Last()
+	if k == nil {
+		return 0
+	}
+
+	return int64(binary.BigEndian.Uint64(k)) + 1
+}
+
+func (l *BoltLogStore) Lookup(key string) (int64, error) {
+	var id int64 = -1
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(lookupsBucket).Get([]byte(key))
+		if v != nil {
+			id = int64(binary.BigEndian.Uint64(v))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed looking up %s", key)
+	}
+
+	if id < 0 {
+		return 0, services.NewErrNotFound("%s is not in the checksum log", key)
+	}
+
+	return id, nil
+}
+
+func (l *BoltLogStore) ReadRecords(id, n int64) ([][]byte, error) {
+	records := [][]byte{}
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(recordsBucket)
+		for i := id; i < id+n; i++ {
+			v := bucket.Get(logKey(i))
+			if v == nil {
+				return services.NewErrNotFound("record %d is not in the checksum log", i)
+			}
+			records = append(records, append([]byte{}, v...))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (l *BoltLogStore) ReadHashes(indexes []int64) ([]tlog.Hash, error) {
+	hashes := make([]tlog.Hash, 0, len(indexes))
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(hashesBucket)
+		for _, index := range indexes {
+			v := bucket.Get(logKey(index))
+			if v == nil {
+				return services.NewErrNotFound("hash %d is not in the checksum log", index)
+			}
+			var hash tlog.Hash
+			copy(hash[:], v)
+			hashes = append(hashes, hash)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
+}
+
+func (l *BoltLogStore) Append(id int64, key string, record []byte, hashes []tlog.Hash) error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		if size := treeSize(tx); size != id {
+			return errors.Errorf("can't append record %d to a checksum log of size %d", id, size)
+		}
+
+		err := tx.Bucket(recordsBucket).Put(logKey(id), record)
+		if err != nil {
+			return errors.Wrap(err, "failed storing record")
+		}
+
+		err = tx.Bucket(lookupsBucket).Put([]byte(key), logKey(id))
+		if err != nil {
+			return errors.Wrap(err, "failed storing lookup")
+		}
+
+		bucket := tx.Bucket(hashesBucket)
+		index := tlog.StoredHashIndex(0, id)
+		// bolt holds on to values until the transaction commits, so they
+		// can't point into a reused loop variable
+		for i := range hashes {
+			err = bucket.Put(logKey(index+int64(i)), hashes[i][:])
+			if err != nil {
+				return errors.Wrap(err, "failed storing hash")
+			}
+		}
+
+		return nil
+	})
+}
+
+func logKey(i int64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(i))
+	return k
+}
@@ -0,0 +1,167 @@
+package storage_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type fakeS3Object struct {
+	data     []byte
+	modified time.Time
+}
+
+// FakeS3 is an in memory S3 server that understands the path style requests
+// S3Storage makes against a single bucket.
+type FakeS3 struct {
+	bucket  string
+	mu      sync.Mutex
+	objects map[string]*fakeS3Object
+	server  *httptest.Server
+}
+
+func NewFakeS3(bucket string) *FakeS3 {
+	f := &FakeS3{bucket: bucket, objects: map[string]*fakeS3Object{}}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+func (f *FakeS3) URL() string {
+	return f.server.URL
+}
+
+func (f *FakeS3) Close() {
+	f.server.Close()
+}
+
+func (f *FakeS3) Keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := []string{}
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (f *FakeS3) handle(w http.ResponseWriter, r *http.Request) {
+	bucketPrefix := "/" + f.bucket
+	if !strings.HasPrefix(r.URL.Path, bucketPrefix) {
+		http.Error(w, "no such bucket", 404)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, bucketPrefix), "/")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, r)
+	case r.Method == http.MethodPut:
+		if _, ok := f.objects[key]; ok && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(412)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>PreconditionFailed</Code><Message>object exists</Message></Error>`)
+			return
+		}
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		f.objects[key] = &fakeS3Object{data, time.Now().UTC().Truncate(time.Second)}
+		w.WriteHeader(200)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(204)
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		object, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(404)
+			if r.Method == http.MethodGet {
+				fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			}
+			return
+		}
+
+		data := object.data
+		status := 200
+		if rng := r.Header.Get("Range"); rng != "" {
+			start, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(data)-1, len(data)))
+			data = data[start:]
+			status = 206
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", object.modified.Format(http.TimeFormat))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	default:
+		http.Error(w, "method not allowed", 405)
+	}
+}
+
+type fakeS3ListResult struct {
+	XMLName     xml.Name           `xml:"ListBucketResult"`
+	Name        string             `xml:"Name"`
+	Prefix      string             `xml:"Prefix"`
+	KeyCount    int                `xml:"KeyCount"`
+	IsTruncated bool               `xml:"IsTruncated"`
+	Contents    []fakeS3ListObject `xml:"Contents"`
+}
+
+type fakeS3ListObject struct {
+	Key          string `xml:"Key"`
+	Size         int    `xml:"Size"`
+	LastModified string `xml:"LastModified"`
+}
+
+func (f *FakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	maxKeys, err := strconv.Atoi(r.URL.Query().Get("max-keys"))
+	if err != nil {
+		maxKeys = 1000
+	}
+
+	keys := []string{}
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := fakeS3ListResult{Name: f.bucket, Prefix: prefix}
+	for _, key := range keys {
+		if len(result.Contents) == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+
+		object := f.objects[key]
+		result.Contents = append(result.Contents, fakeS3ListObject{
+			Key:          key,
+			Size:         len(object.data),
+			LastModified: object.modified.Format(time.RFC3339),
+		})
+	}
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(200)
+	xml.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/pkg/errors"
+)
+
+// FileAuditLog appends audit events to a file as JSON lines, syncing each one
+// to disk before the action is reported done.
+type FileAuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileAuditLog(path string) (*FileAuditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed opening audit log")
+	}
+
+	return &FileAuditLog{file: file}, nil
+}
+
+func (l *FileAuditLog) Record(event *services.AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed marshalling audit event")
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = l.file.Write(line)
+	if err != nil {
+		return errors.Wrap(err, "failed writing audit event")
+	}
+
+	err = l.file.Sync()
+	if err != nil {
+		return errors.Wrap(err, "failed syncing audit log")
+	}
+
+	return nil
+}
+
+func (l *FileAuditLog) Close() error {
+	return l.file.Close()
+}
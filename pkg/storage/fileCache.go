@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/pkg/errors"
+)
+
+// FileCache is a Cache keeping each key in a file under basePath.
+type FileCache struct {
+	basePath string
+}
+
+func NewFileCache(basePath string) (*FileCache, error) {
+	err := os.MkdirAll(basePath, os.ModePerm)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed creating cache directory")
+	}
+
+	return &FileCache{basePath}, nil
+}
+
+func (c *FileCache) Get(key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(c.file(key))
+	if os.IsNotExist(err) {
+		return nil, services.NewErrNotFound("%s is not cached", key)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed reading cached %s", key)
+	}
+
+	return data, nil
+}
+
+func (c *FileCache) Put(key string, data []byte) error {
+	file := c.file(key)
+
+	err := os.MkdirAll(path.Dir(file), os.ModePerm)
+	if err != nil {
+		return errors.Wrapf(err, "failed creating cache directory for %s", key)
+	}
+
+	// write to a temporary file first so readers never see a partial entry
+	tmp, err := ioutil.TempFile(path.Dir(file), ".tmp-")
+	if err != nil {
+		return errors.Wrapf(err, "failed creating cache file for %s", key)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "failed writing cache file for %s", key)
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return errors.Wrapf(err, "failed closing cache file for %s", key)
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
+// file is the file of a key, cleaned so that keys can't escape basePath.
+func (c *FileCache) file(key string) string {
+	return path.Join(c.basePath, path.Clean("/"+key))
+}
@@ -2,54 +2,170 @@ package storage
 
 import (
 	"archive/zip"
-	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
-	"regexp"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/annymsmthd/go-modules-registry/pkg/api"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
 
-	"github.com/coreos/go-semver/semver"
-	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/mod/modfile"
+	gomodule "golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 )
 
+// FileStorage keeps each module version in its own directory at
+// {basePath}/{module}/@v/{version}/, with the module path and version
+// case-encoded the way the go command does so that modules differing only in
+// case can't collide on case-insensitive file systems. Versions are staged
+// under {basePath}/tmp/ and published with a single rename, so a version
+// directory is either complete or not there at all.
+//
+// A version directory holds its version.info, source.zip and a blobs.json
+// referencing its go.mod, which is kept by its SHA-256 under
+// {basePath}/blobs/ so that the go.mod most versions of a module share is
+// only stored once. Zips are kept with their version, every file in a zip is
+// prefixed with its module@version so no two versions have the same zip.
 type FileStorage struct {
 	basePath string
+	locks    *keyedMutex
+	blobs    *blobStore
 }
 
+// versionBlobs is the blobs.json of a version, with the hash of its go.mod.
+type versionBlobs struct {
+	Mod string
+}
+
+// staleWorkDirAge is how old a working directory under tmp/ has to be before
+// it is taken to be left over from a crash rather than an upload in progress
+// by another process sharing the storage.
+const staleWorkDirAge = time.Hour
+
+// versionFiles are the files of a complete version directory.
+var versionFiles = []string{"version.info", "source.zip", "blobs.json"}
+
 func NewFileStorage(basePath string) (*FileStorage, error) {
 	_, err := os.Stat(basePath)
 	if err != nil {
 		return nil, errors.Wrap(err, "file storage directory does not exist")
 	}
 
-	return &FileStorage{basePath}, nil
+	blobs, err := newBlobStore(path.Join(basePath, "blobs"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileStorage{basePath: basePath, locks: newKeyedMutex(), blobs: blobs}, nil
 }
 
-func (s *FileStorage) HasModule(module string) bool {
-	fileModule := strings.Replace(module, "/", "_", -1)
-	_, err := os.Stat(path.Join(s.basePath, fileModule))
+// Recover migrates storage written by older releases and cleans up after
+// crashes. It removes what it takes to be left over, so it is only run by the
+// server as it starts rather than by every user of the storage, such as
+// commands run against a directory a live server is publishing to.
+func (s *FileStorage) Recover() error {
+	err := s.migrateLegacyLayout()
+	if err != nil {
+		return errors.Wrap(err, "failed migrating storage layout")
+	}
 
-	return err == nil
+	err = s.migrateToBlobs()
+	if err != nil {
+		return errors.Wrap(err, "failed moving version files into blobs")
+	}
+
+	err = s.recover()
+	if err != nil {
+		return errors.Wrap(err, "failed recovering storage")
+	}
+
+	return nil
+}
+
+func (s *FileStorage) HasModule(module string) (bool, error) {
+	versionsDir, err := s.versionsDir(module)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(versionsDir)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed checking versions directory")
+	}
+
+	return true, nil
+}
+
+func (s *FileStorage) Modules() ([]string, error) {
+	modules := []string{}
+	tmpDir := path.Join(s.basePath, "tmp")
+	blobsDir := path.Join(s.basePath, "blobs")
+
+	err := filepath.Walk(s.basePath, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		if file == tmpDir || file == blobsDir {
+			return filepath.SkipDir
+		}
+
+		if info.Name() != "@v" {
+			return nil
+		}
+
+		escaped, err := filepath.Rel(s.basePath, filepath.Dir(file))
+		if err != nil {
+			return err
+		}
+
+		module, err := gomodule.UnescapePath(filepath.ToSlash(escaped))
+		if err != nil {
+			return errors.Wrapf(err, "invalid module directory %s", escaped)
+		}
+
+		modules = append(modules, module)
+
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed walking module directories")
+	}
+
+	return modules, nil
 }
 
 func (s *FileStorage) ModuleVersions(module string) ([]string, error) {
-	fileModule := strings.Replace(module, "/", "_", -1)
-	moduleDir := path.Join(s.basePath, fileModule)
+	versionsDir, err := s.versionsDir(module)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := os.Stat(moduleDir)
+	_, err = os.Stat(versionsDir)
+	if os.IsNotExist(err) {
+		return nil, services.NewErrModuleDoesntExist(module)
+	}
 	if err != nil {
-		return nil, errors.Wrap(err, "module directory does not exist")
+		return nil, errors.Wrap(err, "failed checking module directory")
 	}
 
-	files, err := ioutil.ReadDir(moduleDir)
+	files, err := ioutil.ReadDir(versionsDir)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed reading version directories")
 	}
@@ -61,19 +177,29 @@ func (s *FileStorage) ModuleVersions(module string) ([]string, error) {
 			continue
 		}
 
-		versions = append(versions, fmt.Sprintf("v%s", f.Name()))
+		version, err := gomodule.UnescapeVersion(f.Name())
+		if err != nil {
+			continue
+		}
+
+		versions = append(versions, version)
 	}
 
 	return versions, nil
 }
 
-func (s *FileStorage) VersionInfo(module string, version *semver.Version) (*api.VersionInfo, error) {
-	fileModule := strings.Replace(module, "/", "_", -1)
-	versionDir := path.Join(s.basePath, fileModule, version.String())
+func (s *FileStorage) VersionInfo(module, version string) (*api.VersionInfo, error) {
+	versionDir, err := s.versionDir(module, version)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := os.Stat(versionDir)
+	_, err = os.Stat(versionDir)
+	if os.IsNotExist(err) {
+		return nil, services.NewErrVersionDoesntExist(module, version)
+	}
 	if err != nil {
-		return nil, errors.Wrap(err, "version directory does not exist")
+		return nil, errors.Wrap(err, "failed checking version directory")
 	}
 
 	infoFile := path.Join(versionDir, "version.info")
@@ -96,24 +222,37 @@ func (s *FileStorage) VersionInfo(module string, version *semver.Version) (*api.
 	return &versionInfo, nil
 }
 
-func (s *FileStorage) Mod(module string, version *semver.Version) (io.ReadSeeker, *time.Time, error) {
-	fileModule := strings.Replace(module, "/", "_", -1)
-	versionDir := path.Join(s.basePath, fileModule, version.String())
+func (s *FileStorage) Mod(module, version string) (io.ReadSeekCloser, *time.Time, error) {
+	return s.openVersionFile(module, version, func(versionDir string, blobs *versionBlobs) (*os.File, error) {
+		return s.blobs.open(blobs.Mod)
+	})
+}
+
+func (s *FileStorage) Source(module, version string) (io.ReadSeekCloser, *time.Time, error) {
+	return s.openVersionFile(module, version, func(versionDir string, blobs *versionBlobs) (*os.File, error) {
+		return os.Open(path.Join(versionDir, "source.zip"))
+	})
+}
 
-	_, err := os.Stat(versionDir)
+// openVersionFile opens the file of the version opened by open, along with
+// the time the version was published. The caller must close the file.
+func (s *FileStorage) openVersionFile(module, version string, open func(versionDir string, blobs *versionBlobs) (*os.File, error)) (io.ReadSeekCloser, *time.Time, error) {
+	versionDir, err := s.versionDir(module, version)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "version directory does not exist")
+		return nil, nil, err
 	}
 
-	modFile := path.Join(versionDir, "go.mod")
-	info, err := os.Stat(modFile)
+	blobs, info, err := readVersionBlobs(versionDir)
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil, nil, services.NewErrVersionDoesntExist(module, version)
+	}
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed getting go.mod")
+		return nil, nil, err
 	}
 
-	file, err := os.Open(modFile)
+	file, err := open(versionDir, blobs)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed opening go.mod")
+		return nil, nil, errors.Wrapf(err, "failed opening file of %s@%s", module, version)
 	}
 
 	modTime := info.ModTime()
@@ -121,152 +260,659 @@ func (s *FileStorage) Mod(module string, version *semver.Version) (io.ReadSeeker
 	return file, &modTime, nil
 }
 
-func (s *FileStorage) Source(module string, version *semver.Version) (io.ReadSeeker, *time.Time, error) {
-	fileModule := strings.Replace(module, "/", "_", -1)
-	versionDir := path.Join(s.basePath, fileModule, version.String())
+func readVersionBlobs(versionDir string) (*versionBlobs, os.FileInfo, error) {
+	blobsFile := path.Join(versionDir, "blobs.json")
+	info, err := os.Stat(blobsFile)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed getting blobs.json")
+	}
 
-	_, err := os.Stat(versionDir)
+	dat, err := ioutil.ReadFile(blobsFile)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "version directory does not exist")
+		return nil, nil, errors.Wrap(err, "failed reading blobs.json")
 	}
 
-	sourceFile := path.Join(versionDir, "source.zip")
-	info, err := os.Stat(sourceFile)
+	var blobs versionBlobs
+	err = json.Unmarshal(dat, &blobs)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed getting source.zip")
+		return nil, nil, errors.Wrap(err, "failed unmarshalling blobs.json")
 	}
 
-	file, err := os.Open(sourceFile)
+	return &blobs, info, nil
+}
+
+// storeVersionBlobs puts the go.mod in versionDir into the blob store, and
+// replaces it with a blobs.json referencing it.
+func (s *FileStorage) storeVersionBlobs(versionDir string) error {
+	modFile := path.Join(versionDir, "go.mod")
+
+	modHash, err := s.blobs.put(modFile)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed opening source.zip")
+		return err
 	}
 
-	modTime := info.ModTime()
+	dat, err := json.Marshal(&versionBlobs{Mod: modHash})
+	if err != nil {
+		return errors.Wrap(err, "failed marshalling blobs.json")
+	}
 
-	return file, &modTime, nil
+	// write blobs.json before removing the go.mod it replaces, so a version
+	// always has one or the other
+	tmp := path.Join(versionDir, ".blobs.json")
+	err = ioutil.WriteFile(tmp, dat, 0644)
+	if err == nil {
+		err = syncFile(tmp)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path.Join(versionDir, "blobs.json"))
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed writing blobs.json")
+	}
+
+	err = os.Remove(modFile)
+	if err != nil {
+		return errors.Wrap(err, "failed removing stored go.mod")
+	}
+
+	return nil
 }
 
-func (s *FileStorage) CreateModuleVersion(module string, version *semver.Version, file io.ReadCloser) error {
-	fileModule := strings.Replace(module, "/", "_", -1)
-	finalDir := path.Join(s.basePath, fileModule, version.String())
+func (s *FileStorage) CreateModuleVersion(module, version string, file io.ReadCloser) error {
+	return s.createModuleVersion(module, version, file, nil, nil)
+}
+
+// MirrorModuleVersion stores a version pulled from an upstream with the info
+// and go.mod the upstream serves for it.
+func (s *FileStorage) MirrorModuleVersion(module, version string, info *api.VersionInfo, mod io.Reader, file io.ReadCloser) error {
+	return s.createModuleVersion(module, version, file, info, mod)
+}
+
+func (s *FileStorage) createModuleVersion(module, version string, file io.ReadCloser, info *api.VersionInfo, mod io.Reader) error {
+	finalDir, err := s.versionDir(module, version)
+	if err != nil {
+		return err
+	}
+
+	unlock := s.locks.lock(module + "@" + version)
+	defer unlock()
 
 	f, _ := os.Stat(finalDir)
 	if f != nil {
-		return fmt.Errorf("version already exists")
+		return services.NewErrVersionExists(module, version)
 	}
 
-	tmpDir := path.Join(s.basePath, "tmp")
+	staged, err := stageModuleVersion(path.Join(s.basePath, "tmp"), module, version, file, info, mod)
+	if err != nil {
+		return err
+	}
+	defer staged.Close()
 
-	id := uuid.New()
+	// keep the blobs from being collected until the version references them
+	unlockBlobs, err := s.blobs.lock(false)
+	if err != nil {
+		return err
+	}
+	defer unlockBlobs()
 
-	if _, err := os.Stat(tmpDir); err != nil {
-		err = os.Mkdir(tmpDir, os.ModePerm)
-		if err != nil {
-			return errors.Wrap(err, "failed creating tmp directory")
+	err = s.storeVersionBlobs(staged.workDir)
+	if err != nil {
+		return err
+	}
+
+	// the working directory now holds exactly the files of a version, so it
+	// can be published with one rename once they are on disk
+	err = syncDir(staged.workDir, true)
+	if err != nil {
+		return errors.Wrap(err, "failed syncing staged version")
+	}
+
+	err = os.MkdirAll(path.Dir(finalDir), os.ModePerm)
+	if err != nil {
+		return errors.Wrap(err, "failed creating versions dir")
+	}
+
+	// renaming fails when the version directory exists and isn't empty,
+	// such as when another process sharing the storage published it first
+	err = os.Rename(staged.workDir, finalDir)
+	if err != nil {
+		if _, statErr := os.Stat(path.Join(finalDir, "version.info")); statErr == nil {
+			return services.NewErrVersionExists(module, version)
 		}
+		return errors.Wrap(err, "failed publishing version")
+	}
+
+	err = syncDir(path.Dir(finalDir), false)
+	if err != nil {
+		return errors.Wrap(err, "failed syncing versions dir")
 	}
 
-	workDir := path.Join(tmpDir, id.String())
+	return nil
+}
 
-	err := os.Mkdir(workDir, os.ModePerm)
+// DeleteModuleVersion removes the version's directory along with its go.mod
+// blob unless another version shares it, so the version's files are gone for
+// good.
+func (s *FileStorage) DeleteModuleVersion(module, version string) error {
+	versionDir, err := s.versionDir(module, version)
 	if err != nil {
-		return errors.Wrap(err, "failed creating working directory")
+		return err
 	}
-	defer os.RemoveAll(workDir)
 
-	zipFile := path.Join(workDir, "source.zip")
-	source, err := os.Create(zipFile)
+	unlock := s.locks.lock(module + "@" + version)
+	defer unlock()
+
+	_, err = os.Stat(versionDir)
+	if os.IsNotExist(err) {
+		return services.NewErrVersionDoesntExist(module, version)
+	}
 	if err != nil {
-		return errors.Wrap(err, "failed creating source.zip file")
+		return errors.Wrap(err, "failed checking version directory")
 	}
-	defer source.Close()
 
-	_, err = io.Copy(source, file)
+	unlockBlobs, err := s.blobs.lock(true)
 	if err != nil {
-		return errors.Wrap(err, "failed copying file to source.zip")
+		return err
 	}
+	defer unlockBlobs()
 
-	err = source.Close()
+	blobs, _, err := readVersionBlobs(versionDir)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return err
+	}
+
+	// remove version.info first so the version is incomplete, and cleaned
+	// up on startup, should removing the rest fail
+	err = os.Remove(path.Join(versionDir, "version.info"))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed removing version.info")
+	}
+
+	err = os.RemoveAll(versionDir)
 	if err != nil {
-		return errors.Wrap(err, "failed closing source")
+		return errors.Wrap(err, "failed removing version directory")
+	}
+
+	if blobs == nil {
+		return nil
 	}
 
-	modFile, err := s.extractModFile(workDir, zipFile, module, version.String())
+	// should removing the blobs fail, CollectGarbage removes them later
+	referenced, err := s.referencedBlobs()
 	if err != nil {
 		return err
 	}
 
-	modName, err := ModName(modFile)
+	if referenced[blobs.Mod] {
+		return nil
+	}
+
+	return s.blobs.remove(blobs.Mod)
+}
+
+// Metadata reads the module's metadata from metadata.json in the directory
+// holding its versions.
+func (s *FileStorage) Metadata(module string) (*api.ModuleMetadata, error) {
+	versionsDir, err := s.versionsDir(module)
+	if err != nil {
+		return nil, err
+	}
+
+	dat, err := ioutil.ReadFile(path.Join(versionsDir, "metadata.json"))
+	if os.IsNotExist(err) {
+		return &api.ModuleMetadata{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading metadata.json")
+	}
+
+	var metadata api.ModuleMetadata
+	err = json.Unmarshal(dat, &metadata)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed unmarshalling ModuleMetadata")
+	}
+
+	return &metadata, nil
+}
+
+func (s *FileStorage) SetMetadata(module string, metadata *api.ModuleMetadata) error {
+	versionsDir, err := s.versionsDir(module)
 	if err != nil {
 		return err
 	}
 
-	if modName != module {
-		return fmt.Errorf("module in go.mod must match module name given")
+	_, err = os.Stat(versionsDir)
+	if os.IsNotExist(err) {
+		return services.NewErrModuleDoesntExist(module)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed checking module directory")
 	}
 
-	versionString := fmt.Sprintf("v%s", version.String())
-	versionInfo := api.VersionInfo{
-		Name:    versionString,
-		Short:   versionString,
-		Time:    time.Now(),
-		Version: versionString,
+	dat, err := json.Marshal(metadata)
+	if err != nil {
+		return errors.Wrap(err, "failed marshalling ModuleMetadata")
 	}
 
-	versionBytes, err := json.Marshal(versionInfo)
+	// write a temporary file and rename it so readers never see a partly
+	// written file
+	f, err := ioutil.TempFile(versionsDir, ".metadata-*.json")
 	if err != nil {
-		return errors.Wrap(err, "failed marshaling version info")
+		return errors.Wrap(err, "failed creating metadata.json")
 	}
+	defer os.Remove(f.Name())
 
-	versionInfoFile := path.Join(workDir, "version.info")
-	vf, err := os.Create(versionInfoFile)
+	_, err = f.Write(dat)
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
 	if err != nil {
-		return errors.Wrap(err, "failed creating version info file")
+		return errors.Wrap(err, "failed writing metadata.json")
 	}
-	defer vf.Close()
 
-	_, err = vf.Write(versionBytes)
+	err = os.Rename(f.Name(), path.Join(versionsDir, "metadata.json"))
 	if err != nil {
-		return errors.Wrap(err, "failed writing version info bytes")
+		return errors.Wrap(err, "failed moving metadata.json")
 	}
 
-	err = os.MkdirAll(finalDir, os.ModePerm)
+	return nil
+}
+
+// versionsDir is the directory holding every version of the module.
+func (s *FileStorage) versionsDir(module string) (string, error) {
+	escaped, err := gomodule.EscapePath(module)
 	if err != nil {
-		return errors.Wrap(err, "failed creating final dir")
+		return "", services.NewErrInvalid("%v", err)
 	}
 
-	newVersionInfo := path.Join(finalDir, "version.info")
-	newSource := path.Join(finalDir, "source.zip")
-	newMod := path.Join(finalDir, "go.mod")
+	return path.Join(s.basePath, escaped, "@v"), nil
+}
 
-	err = os.Rename(versionInfoFile, newVersionInfo)
+func (s *FileStorage) versionDir(module, version string) (string, error) {
+	versionsDir, err := s.versionsDir(module)
 	if err != nil {
-		return errors.Wrap(err, "failed moving version.info file")
+		return "", err
+	}
+
+	escaped, err := gomodule.EscapeVersion(version)
+	if err != nil {
+		return "", services.NewErrInvalid("%v", err)
+	}
+
+	return path.Join(versionsDir, escaped), nil
+}
+
+// Ready checks that files can be written to the storage directory, by
+// writing and removing a probe file under tmp/.
+func (s *FileStorage) Ready(ctx context.Context) error {
+	// a missing storage directory, such as an unmounted volume, isn't
+	// recreated
+	tmpDir := path.Join(s.basePath, "tmp")
+	err := os.Mkdir(tmpDir, os.ModePerm)
+	if err != nil && !os.IsExist(err) {
+		return errors.Wrap(err, "storage directory is not writable")
+	}
+
+	f, err := ioutil.TempFile(tmpDir, "ready-")
+	if err != nil {
+		return errors.Wrap(err, "storage directory is not writable")
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write([]byte("ok"))
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		return errors.Wrap(err, "storage directory is not writable")
+	}
+
+	return nil
+}
+
+// recover cleans up after crashes, removing working directories left in tmp/
+// and version directories missing some of their files. Storage written by
+// older releases could be left with incomplete versions as they published
+// one file at a time.
+func (s *FileStorage) recover() error {
+	tmpDir := path.Join(s.basePath, "tmp")
+	workDirs, err := ioutil.ReadDir(tmpDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, w := range workDirs {
+		if time.Since(w.ModTime()) < staleWorkDirAge {
+			continue
+		}
+
+		err = os.RemoveAll(path.Join(tmpDir, w.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	modules, err := s.Modules()
+	if err != nil {
+		return err
+	}
+
+	for _, module := range modules {
+		versionsDir, err := s.versionsDir(module)
+		if err != nil {
+			return err
+		}
+
+		files, err := ioutil.ReadDir(versionsDir)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			file := path.Join(versionsDir, f.Name())
+
+			// metadata being written when the process stopped
+			if !f.IsDir() {
+				if strings.HasPrefix(f.Name(), ".metadata-") {
+					os.Remove(file)
+				}
+				continue
+			}
+
+			if isCompleteVersion(file) {
+				continue
+			}
+
+			logrus.WithFields(logrus.Fields{"module": module, "version": f.Name()}).Warn("removing incomplete version")
+			err = os.RemoveAll(file)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func isCompleteVersion(versionDir string) bool {
+	for _, name := range versionFiles {
+		_, err := os.Stat(path.Join(versionDir, name))
+		if err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// syncDir flushes dir to disk, along with the files in it when files is set,
+// so that a rename of it or in it survives a crash.
+func syncDir(dir string, files bool) error {
+	if files {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, info := range infos {
+			err = syncFile(path.Join(dir, info.Name()))
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	err = os.Rename(zipFile, newSource)
+	return syncFile(dir)
+}
+
+func syncFile(name string) error {
+	f, err := os.Open(name)
 	if err != nil {
-		return errors.Wrap(err, "failed moving source.zip file")
+		return err
 	}
+	defer f.Close()
+
+	return f.Sync()
+}
 
-	err = os.Rename(modFile, newMod)
+// migrateToBlobs moves the go.mod of versions stored before blobs were used
+// into the blob store. It picks up where it left off when
+// stopped part way.
+func (s *FileStorage) migrateToBlobs() error {
+	unlockBlobs, err := s.blobs.lock(false)
 	if err != nil {
-		return errors.Wrap(err, "failed moving source.zip file")
+		return err
+	}
+	defer unlockBlobs()
+
+	modules, err := s.Modules()
+	if err != nil {
+		return err
+	}
+
+	for _, module := range modules {
+		versions, err := s.ModuleVersions(module)
+		if err != nil {
+			return err
+		}
+
+		for _, version := range versions {
+			versionDir, err := s.versionDir(module, version)
+			if err != nil {
+				return err
+			}
+
+			_, err = os.Stat(path.Join(versionDir, "go.mod"))
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			_, err = os.Stat(path.Join(versionDir, "blobs.json"))
+			if err == nil {
+				// stopped after writing blobs.json
+				os.Remove(path.Join(versionDir, "go.mod"))
+				continue
+			}
+
+			if !fileExists(path.Join(versionDir, "source.zip")) || !fileExists(path.Join(versionDir, "version.info")) {
+				// incomplete, left for recover to remove
+				continue
+			}
+
+			err = s.storeVersionBlobs(versionDir)
+			if err != nil {
+				return errors.Wrapf(err, "failed migrating %s@%s", module, version)
+			}
+		}
 	}
 
 	return nil
 }
 
-func (s *FileStorage) extractModFile(workDir, zipFile, module, version string) (string, error) {
+func fileExists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// Verify checks every version references blobs that exist, and that every
+// blob's contents still hash to its name, returning the problems found.
+func (s *FileStorage) Verify() ([]string, error) {
+	problems := []string{}
+
+	err := s.walkVersionBlobs(func(module, version string, blobs *versionBlobs) error {
+		blob, err := s.blobs.path(blobs.Mod)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s@%s: %v", module, version, err))
+			return nil
+		}
+
+		if !fileExists(blob) {
+			problems = append(problems, fmt.Sprintf("%s@%s: blob %s is missing", module, version, blobs.Mod))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.blobs.walk(func(hash string, info os.FileInfo) error {
+		err := s.blobs.verify(hash)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed walking blobs")
+	}
+
+	return problems, nil
+}
+
+// CollectGarbage removes the blobs no version references, such as those
+// left by uploads that failed part way, returning how many were removed.
+func (s *FileStorage) CollectGarbage() (int, error) {
+	unlockBlobs, err := s.blobs.lock(true)
+	if err != nil {
+		return 0, err
+	}
+	defer unlockBlobs()
+
+	referenced, err := s.referencedBlobs()
+	if err != nil {
+		return 0, err
+	}
+
+	return s.blobs.collect(referenced)
+}
+
+// referencedBlobs returns the hashes of the blobs versions reference.
+func (s *FileStorage) referencedBlobs() (map[string]bool, error) {
+	referenced := map[string]bool{}
+
+	err := s.walkVersionBlobs(func(module, version string, blobs *versionBlobs) error {
+		referenced[blobs.Mod] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return referenced, nil
+}
+
+func (s *FileStorage) walkVersionBlobs(fn func(module, version string, blobs *versionBlobs) error) error {
+	modules, err := s.Modules()
+	if err != nil {
+		return err
+	}
+
+	for _, module := range modules {
+		versions, err := s.ModuleVersions(module)
+		if err != nil {
+			return err
+		}
+
+		for _, version := range versions {
+			versionDir, err := s.versionDir(module, version)
+			if err != nil {
+				return err
+			}
+
+			blobs, _, err := readVersionBlobs(versionDir)
+			if os.IsNotExist(errors.Cause(err)) {
+				// deleted since it was listed
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed reading blobs of %s@%s", module, version)
+			}
+
+			err = fn(module, version, blobs)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// migrateLegacyLayout moves versions stored in the old layout of
+// {basePath}/{module with / replaced by _}/{version without v}/ to their
+// case-encoded location, reading the module path from their go.mod.
+func (s *FileStorage) migrateLegacyLayout() error {
+	files, err := ioutil.ReadDir(s.basePath)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if !f.IsDir() || f.Name() == "tmp" || f.Name() == "blobs" {
+			continue
+		}
+
+		legacyDir := path.Join(s.basePath, f.Name())
+		versions, err := ioutil.ReadDir(legacyDir)
+		if err != nil {
+			return err
+		}
+
+		migrated := false
+		for _, v := range versions {
+			oldDir := path.Join(legacyDir, v.Name())
+			modName, err := ModName(path.Join(oldDir, "go.mod"))
+			if err != nil {
+				// not a legacy version directory
+				continue
+			}
+
+			version := "v" + v.Name()
+			if !semver.IsValid(version) {
+				return fmt.Errorf("invalid legacy version directory %s", oldDir)
+			}
+
+			newDir, err := s.versionDir(modName, version)
+			if err != nil {
+				return err
+			}
+
+			err = os.MkdirAll(path.Dir(newDir), os.ModePerm)
+			if err != nil {
+				return err
+			}
+
+			err = os.Rename(oldDir, newDir)
+			if err != nil {
+				return err
+			}
+			migrated = true
+		}
+
+		if migrated {
+			// only removes the legacy directory once it is empty
+			os.Remove(legacyDir)
+		}
+	}
+
+	return nil
+}
+
+func extractModFile(workDir, zipFile, module, version string) (string, error) {
 	reader, err := zip.OpenReader(zipFile)
 	if err != nil {
-		return "", errors.Wrap(err, "failed opening source as zip")
+		return "", services.NewErrInvalid("source is not a valid zip file: %v", err)
 	}
 	defer reader.Close()
 
 	modFile := path.Join(workDir, "go.mod")
 
-	prefix := module + "@v" + version
+	prefix := module + "@" + version
 	search := fmt.Sprintf("%s/go.mod", prefix)
 
 	for _, file := range reader.File {
@@ -274,6 +920,10 @@ func (s *FileStorage) extractModFile(workDir, zipFile, module, version string) (
 			continue
 		}
 
+		if semver.Build(version) == "+incompatible" {
+			return "", services.NewErrInvalidModuleVersion(module, version, "the module has a go.mod file, so v2 and above must be published under a module path ending in the major version rather than as +incompatible")
+		}
+
 		zf, err := file.Open()
 		if err != nil {
 			return "", errors.Wrap(err, "error opening zipped go.mod")
@@ -294,34 +944,27 @@ func (s *FileStorage) extractModFile(workDir, zipFile, module, version string) (
 		return modFile, nil
 	}
 
-	return "", fmt.Errorf("go.mod not found in source.zip")
+	// like the go command, synthesize a go.mod for versions without one such
+	// as +incompatible versions of code that predates modules
+	err = ioutil.WriteFile(modFile, []byte(fmt.Sprintf("module %s\n", module)), 0644)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating go.mod")
+	}
+
+	return modFile, nil
 }
 
+// ModName reads the module path declared in a go.mod file.
 func ModName(modFile string) (string, error) {
-	file, err := os.Open(modFile)
+	data, err := ioutil.ReadFile(modFile)
 	if err != nil {
 		return "", errors.Wrap(err, "failed opening modFile")
 	}
-	defer file.Close()
 
-	r, err := regexp.Compile("module (.*)")
-	if err != nil {
-		return "", err
+	modName := modfile.ModulePath(data)
+	if modName == "" {
+		return "", fmt.Errorf("failed finding module name in file %s", modFile)
 	}
 
-	reader := bufio.NewReader(file)
-
-	for {
-		line, _, err := reader.ReadLine()
-		if err != nil {
-			return "", errors.Wrap(err, "failed finding module name in file")
-		}
-		found := r.Find(line)
-
-		if len(found) > 0 {
-			foundString := string(found)
-			foundString = strings.Replace(foundString, "module ", "", -1)
-			return foundString, nil
-		}
-	}
+	return modName, nil
 }
@@ -0,0 +1,375 @@
+package storage_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+	"github.com/annymsmthd/go-modules-registry/pkg/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFileStorage(t *testing.T) (*storage.FileStorage, string, func()) {
+	dir, err := ioutil.TempDir("", "storage")
+	require.NoError(t, err)
+
+	s, err := storage.NewFileStorage(dir)
+	require.NoError(t, err)
+
+	return s, dir, func() { os.RemoveAll(dir) }
+}
+
+func createTestVersion(t *testing.T, s *storage.FileStorage, module, version string) {
+	source := moduleZip(t, module+"@"+version+"/", map[string]string{
+		"go.mod": "module " + module + "\n",
+	})
+
+	err := s.CreateModuleVersion(module, version, ioutil.NopCloser(bytes.NewReader(source)))
+	require.NoError(t, err)
+}
+
+func TestFileStorageKeepsCaseVariantsApart(t *testing.T) {
+	s, dir, cleanup := newTestFileStorage(t)
+	defer cleanup()
+
+	createTestVersion(t, s, "github.com/Azure/module", "v1.0.0")
+	createTestVersion(t, s, "github.com/azure/module", "v1.1.0")
+
+	_, err := os.Stat(path.Join(dir, "github.com/!azure/module/@v/v1.0.0/blobs.json"))
+	assert.NoError(t, err)
+
+	versions, err := s.ModuleVersions("github.com/Azure/module")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0"}, versions)
+
+	versions, err = s.ModuleVersions("github.com/azure/module")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.1.0"}, versions)
+
+	modules, err := s.Modules()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"github.com/Azure/module", "github.com/azure/module"}, modules)
+}
+
+func TestFileStorageMigratesLegacyLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	legacyDir := path.Join(dir, "github.com_BurntSushi_toml", "0.3.1")
+	require.NoError(t, os.MkdirAll(legacyDir, os.ModePerm))
+	for file, contents := range map[string]string{
+		"go.mod":       "module github.com/BurntSushi/toml\n",
+		"source.zip":   "zip",
+		"version.info": `{"Version":"v0.3.1"}`,
+	} {
+		require.NoError(t, ioutil.WriteFile(path.Join(legacyDir, file), []byte(contents), 0644))
+	}
+
+	s, err := storage.NewFileStorage(dir)
+	require.NoError(t, err)
+	require.NoError(t, s.Recover())
+
+	versions, err := s.ModuleVersions("github.com/BurntSushi/toml")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v0.3.1"}, versions)
+
+	info, err := s.VersionInfo("github.com/BurntSushi/toml", "v0.3.1")
+	require.NoError(t, err)
+	assert.Equal(t, "v0.3.1", info.Version)
+
+	source, _, err := s.Source("github.com/BurntSushi/toml", "v0.3.1")
+	require.NoError(t, err)
+	defer source.Close()
+	sourceBytes, err := ioutil.ReadAll(source)
+	require.NoError(t, err)
+	assert.Equal(t, "zip", string(sourceBytes))
+
+	_, err = os.Stat(path.Join(dir, "github.com_BurntSushi_toml"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = os.Stat(path.Join(dir, "github.com/!burnt!sushi/toml/@v/v0.3.1/go.mod"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFileStorageSynthesizesGoModForIncompatibleVersions(t *testing.T) {
+	s, _, cleanup := newTestFileStorage(t)
+	defer cleanup()
+
+	source := moduleZip(t, "test.com/module@v2.0.0+incompatible/", map[string]string{
+		"main.go": "package module\n",
+	})
+
+	err := s.CreateModuleVersion("test.com/module", "v2.0.0+incompatible", ioutil.NopCloser(bytes.NewReader(source)))
+	require.NoError(t, err)
+
+	mod, _, err := s.Mod("test.com/module", "v2.0.0+incompatible")
+	require.NoError(t, err)
+	defer mod.Close()
+	modBytes, err := ioutil.ReadAll(mod)
+	require.NoError(t, err)
+	assert.Equal(t, "module test.com/module\n", string(modBytes))
+}
+
+func TestFileStorageMirrorsQuotedAndCommentedGoMod(t *testing.T) {
+	s, _, cleanup := newTestFileStorage(t)
+	defer cleanup()
+
+	mod := "// the module (yaml)\nmodule \"gopkg.in/yaml.v3\" // yaml\n\ngo 1.12\n"
+	source := moduleZip(t, "gopkg.in/yaml.v3@v3.0.1/", map[string]string{
+		"go.mod": mod,
+	})
+
+	err := s.MirrorModuleVersion("gopkg.in/yaml.v3", "v3.0.1", nil, strings.NewReader(mod), ioutil.NopCloser(bytes.NewReader(source)))
+	require.NoError(t, err)
+
+	versions, err := s.ModuleVersions("gopkg.in/yaml.v3")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v3.0.1"}, versions)
+}
+
+func TestFileStorageRejectsIncompatibleVersionsWithGoMod(t *testing.T) {
+	s, _, cleanup := newTestFileStorage(t)
+	defer cleanup()
+
+	source := moduleZip(t, "test.com/module@v2.0.0+incompatible/", map[string]string{
+		"go.mod": "module test.com/module\n",
+	})
+
+	err := s.CreateModuleVersion("test.com/module", "v2.0.0+incompatible", ioutil.NopCloser(bytes.NewReader(source)))
+	assert.IsType(t, services.NewErrInvalidModuleVersion("", "", ""), err)
+	hasModule, err := s.HasModule("test.com/module")
+	require.NoError(t, err)
+	assert.False(t, hasModule)
+}
+
+func TestFileStorageRejectsInvalidModuleZips(t *testing.T) {
+	s, _, cleanup := newTestFileStorage(t)
+	defer cleanup()
+
+	prefix := "test.com/module@v1.0.0/"
+	goMod := "module test.com/module\n"
+
+	symlinkZip := func() []byte {
+		buf := &bytes.Buffer{}
+		w := zip.NewWriter(buf)
+		f, err := w.Create(prefix + "go.mod")
+		require.NoError(t, err)
+		f.Write([]byte(goMod))
+		header := &zip.FileHeader{Name: prefix + "link.go"}
+		header.SetMode(os.ModeSymlink | 0777)
+		f, err = w.CreateHeader(header)
+		require.NoError(t, err)
+		f.Write([]byte("/etc/passwd"))
+		require.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name       string
+		source     []byte
+		violations []string
+	}{
+		{
+			"outside prefix",
+			moduleZip(t, "", map[string]string{prefix + "go.mod": goMod, "other/main.go": ""}),
+			[]string{`other/main.go: path does not have prefix "test.com/module@v1.0.0/"`},
+		},
+		{
+			"nested module",
+			moduleZip(t, prefix, map[string]string{"go.mod": goMod, "sub/go.mod": "module test.com/module/sub\n", "sub/sub.go": ""}),
+			[]string{
+				prefix + "sub/go.mod: go.mod file not in module root directory",
+				prefix + "sub/sub.go: file belongs to the nested module in sub",
+			},
+		},
+		{
+			"vendored package",
+			moduleZip(t, prefix, map[string]string{"go.mod": goMod, "vendor/modules.txt": "", "vendor/test.com/dep/dep.go": ""}),
+			[]string{prefix + "vendor/test.com/dep/dep.go: vendored packages are not allowed, only vendor/modules.txt"},
+		},
+		{
+			"case collision",
+			moduleZip(t, prefix, map[string]string{"go.mod": goMod, "README": "", "readme": ""}),
+			nil,
+		},
+		{
+			"symlink",
+			symlinkZip(),
+			[]string{prefix + "link.go: symbolic links are not allowed"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := s.CreateModuleVersion("test.com/module", "v1.0.0", ioutil.NopCloser(bytes.NewReader(test.source)))
+			require.Error(t, err)
+			assert.Equal(t, services.KindInvalid, services.KindOf(err))
+
+			zipErr, ok := err.(*services.ErrInvalidModuleZip)
+			require.True(t, ok, "expected an invalid module zip error, got %v", err)
+			if test.violations != nil {
+				assert.ElementsMatch(t, test.violations, zipErr.Details())
+			} else {
+				assert.Len(t, zipErr.Details(), 1)
+			}
+		})
+	}
+
+	hasModule, err := s.HasModule("test.com/module")
+	require.NoError(t, err)
+	assert.False(t, hasModule)
+}
+
+func TestFileStoragePublishesConcurrentUploadsOnce(t *testing.T) {
+	s, dir, cleanup := newTestFileStorage(t)
+	defer cleanup()
+
+	source := moduleZip(t, "test.com/module@v1.0.0/", map[string]string{
+		"go.mod": "module test.com/module\n",
+	})
+
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			errs <- s.CreateModuleVersion("test.com/module", "v1.0.0", ioutil.NopCloser(bytes.NewReader(source)))
+		}()
+	}
+
+	created := 0
+	for i := 0; i < cap(errs); i++ {
+		err := <-errs
+		if err == nil {
+			created++
+			continue
+		}
+		assert.Equal(t, services.KindConflict, services.KindOf(err))
+	}
+	assert.Equal(t, 1, created)
+
+	files, err := ioutil.ReadDir(path.Join(dir, "test.com/module/@v/v1.0.0"))
+	require.NoError(t, err)
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	assert.Equal(t, []string{"blobs.json", "source.zip", "version.info"}, names)
+
+	// nothing is left behind in tmp
+	work, err := ioutil.ReadDir(path.Join(dir, "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, work)
+}
+
+func TestFileStorageRecoversFromCrashes(t *testing.T) {
+	s, dir, cleanup := newTestFileStorage(t)
+	defer cleanup()
+
+	createTestVersion(t, s, "test.com/module", "v1.0.0")
+	createTestVersion(t, s, "test.com/module", "v1.1.0")
+
+	// a version half published by an older release
+	require.NoError(t, os.Remove(path.Join(dir, "test.com/module/@v/v1.1.0/version.info")))
+
+	stale := path.Join(dir, "tmp", "stale")
+	require.NoError(t, os.MkdirAll(stale, os.ModePerm))
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(stale, old, old))
+
+	inProgress := path.Join(dir, "tmp", "in-progress")
+	require.NoError(t, os.MkdirAll(inProgress, os.ModePerm))
+
+	// opening the storage leaves it alone, a live server may be publishing
+	s, err := storage.NewFileStorage(dir)
+	require.NoError(t, err)
+
+	_, err = os.Stat(stale)
+	assert.NoError(t, err)
+
+	require.NoError(t, s.Recover())
+
+	versions, err := s.ModuleVersions("test.com/module")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0"}, versions)
+
+	_, err = os.Stat(stale)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = os.Stat(inProgress)
+	assert.NoError(t, err)
+
+	// the incomplete version can be uploaded again
+	createTestVersion(t, s, "test.com/module", "v1.1.0")
+}
+
+func TestFileStorageDeduplicatesAndCollectsBlobs(t *testing.T) {
+	s, dir, cleanup := newTestFileStorage(t)
+	defer cleanup()
+
+	createTestVersion(t, s, "test.com/module", "v1.0.0")
+	createTestVersion(t, s, "test.com/module", "v1.1.0")
+	createTestVersion(t, s, "test.com/other", "v1.0.0")
+
+	blobs := func() []string {
+		files := []string{}
+		err := filepath.Walk(path.Join(dir, "blobs"), func(file string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
+				files = append(files, file)
+			}
+			return err
+		})
+		require.NoError(t, err)
+		return files
+	}
+
+	// the versions of test.com/module share a go.mod
+	assert.Len(t, blobs(), 2)
+
+	problems, err := s.Verify()
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	// deleting a version removes the blobs only it referenced
+	require.NoError(t, s.DeleteModuleVersion("test.com/other", "v1.0.0"))
+	assert.Len(t, blobs(), 1)
+
+	// and keeps those other versions share
+	require.NoError(t, s.DeleteModuleVersion("test.com/module", "v1.0.0"))
+	assert.Len(t, blobs(), 1)
+
+	// such as one stored by an upload that failed part way
+	orphan := path.Join(dir, "blobs", "00", strings.Repeat("0", 64))
+	require.NoError(t, os.MkdirAll(path.Dir(orphan), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(orphan, []byte("orphan"), 0644))
+
+	removed, err := s.CollectGarbage()
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Len(t, blobs(), 1)
+
+	mod, _, err := s.Mod("test.com/module", "v1.1.0")
+	require.NoError(t, err)
+	defer mod.Close()
+	modBytes, err := ioutil.ReadAll(mod)
+	require.NoError(t, err)
+	assert.Equal(t, "module test.com/module\n", string(modBytes))
+
+	// corrupt a blob
+	for _, blob := range blobs() {
+		require.NoError(t, ioutil.WriteFile(blob, []byte("corrupt"), 0644))
+		break
+	}
+
+	problems, err = s.Verify()
+	require.NoError(t, err)
+	assert.Len(t, problems, 1)
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+package storage
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// lockFile takes an advisory lock on file, shared or exclusive, which holds
+// across every process using it. The returned func releases it.
+func lockFile(file string, exclusive bool) (func(), error) {
+	f, err := os.OpenFile(file, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed opening lock file")
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	err = syscall.Flock(int(f.Fd()), how)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "failed locking")
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
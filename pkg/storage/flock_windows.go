@@ -0,0 +1,29 @@
+package storage
+
+import "sync"
+
+var fileLocks = struct {
+	sync.Mutex
+	locks map[string]*sync.RWMutex
+}{locks: map[string]*sync.RWMutex{}}
+
+// lockFile takes a lock on file, shared or exclusive. Without flock it only
+// holds within this process, so storage shouldn't be shared between
+// processes on Windows. The returned func releases it.
+func lockFile(file string, exclusive bool) (func(), error) {
+	fileLocks.Lock()
+	lock, ok := fileLocks.locks[file]
+	if !ok {
+		lock = &sync.RWMutex{}
+		fileLocks.locks[file] = lock
+	}
+	fileLocks.Unlock()
+
+	if exclusive {
+		lock.Lock()
+		return lock.Unlock, nil
+	}
+
+	lock.RLock()
+	return lock.RUnlock, nil
+}
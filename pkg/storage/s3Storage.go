@@ -0,0 +1,675 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	gomodule "golang.org/x/mod/module"
+)
+
+// S3Config configures the bucket S3Storage keeps modules in. Endpoint may be
+// left empty to use AWS itself, and the credentials may be left empty to use
+// the default AWS credential chain.
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3Storage stores modules in an S3 compatible bucket with each version's
+// files under {prefix}/{module}/@v/{version}/, like FileStorage but without
+// sharing blobs between versions.
+type S3Storage struct {
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+func NewS3Storage(config *S3Config) (*S3Storage, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket must be provided")
+	}
+
+	awsConfig := &aws.Config{
+		Region: aws.String(config.Region),
+	}
+
+	if config.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(config.Endpoint)
+		awsConfig.S3ForcePathStyle = aws.Bool(true)
+	}
+
+	if config.AccessKeyID != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(config.AccessKeyID, config.SecretAccessKey, "")
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed creating s3 session")
+	}
+
+	prefix := strings.Trim(config.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &S3Storage{s3.New(sess), config.Bucket, prefix}, nil
+}
+
+func (s *S3Storage) HasModule(module string) (bool, error) {
+	moduleKey, err := s.moduleKey(module)
+	if err != nil {
+		return false, err
+	}
+
+	out, err := s.client.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucket),
+		Prefix:  aws.String(moduleKey),
+		MaxKeys: aws.Int64(1),
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "failed checking for module %s", module)
+	}
+
+	return len(out.Contents) > 0, nil
+}
+
+func (s *S3Storage) Modules() ([]string, error) {
+	seen := map[string]bool{}
+	modules := []string{}
+
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			key := strings.TrimPrefix(aws.StringValue(object.Key), s.prefix)
+			if !strings.HasSuffix(key, "/version.info") {
+				continue
+			}
+
+			i := strings.LastIndex(key, "/@v/")
+			if i < 0 || seen[key[:i]] {
+				continue
+			}
+			seen[key[:i]] = true
+
+			module, err := gomodule.UnescapePath(key[:i])
+			if err != nil {
+				continue
+			}
+
+			modules = append(modules, module)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed listing modules")
+	}
+
+	return modules, nil
+}
+
+func (s *S3Storage) ModuleVersions(module string) ([]string, error) {
+	moduleKey, err := s.moduleKey(module)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []string{}
+
+	err = s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(moduleKey),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			// version.info is written last, so only versions that have one
+			// have been completely uploaded
+			key := strings.TrimPrefix(aws.StringValue(object.Key), moduleKey)
+			if !strings.HasSuffix(key, "/version.info") {
+				continue
+			}
+
+			version, err := gomodule.UnescapeVersion(strings.TrimSuffix(key, "/version.info"))
+			if err != nil {
+				continue
+			}
+
+			versions = append(versions, version)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed listing module versions")
+	}
+
+	if len(versions) == 0 {
+		return nil, services.NewErrModuleDoesntExist(module)
+	}
+
+	return versions, nil
+}
+
+func (s *S3Storage) VersionInfo(module, version string) (*api.VersionInfo, error) {
+	key, err := s.versionKey(module, version, "version.info")
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return nil, services.NewErrVersionDoesntExist(module, version)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed getting version.info")
+	}
+	defer out.Body.Close()
+
+	dat, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading version.info")
+	}
+
+	var versionInfo api.VersionInfo
+	err = json.Unmarshal(dat, &versionInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed unmarshalling VersionInfo")
+	}
+
+	return &versionInfo, nil
+}
+
+func (s *S3Storage) Mod(module, version string) (io.ReadSeekCloser, *time.Time, error) {
+	key, err := s.versionKey(module, version, "go.mod")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, modTime, err := s.openObject(key)
+	if isNotFound(err) {
+		return nil, nil, services.NewErrVersionDoesntExist(module, version)
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed getting go.mod")
+	}
+
+	return reader, modTime, nil
+}
+
+func (s *S3Storage) Source(module, version string) (io.ReadSeekCloser, *time.Time, error) {
+	key, err := s.versionKey(module, version, "source.zip")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, modTime, err := s.openObject(key)
+	if isNotFound(err) {
+		return nil, nil, services.NewErrVersionDoesntExist(module, version)
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed getting source.zip")
+	}
+
+	return reader, modTime, nil
+}
+
+func (s *S3Storage) CreateModuleVersion(module, version string, file io.ReadCloser) error {
+	return s.createModuleVersion(module, version, file, nil, nil)
+}
+
+// MirrorModuleVersion stores a version pulled from an upstream with the info
+// and go.mod the upstream serves for it.
+func (s *S3Storage) MirrorModuleVersion(module, version string, info *api.VersionInfo, mod io.Reader, file io.ReadCloser) error {
+	return s.createModuleVersion(module, version, file, info, mod)
+}
+
+func (s *S3Storage) createModuleVersion(module, version string, file io.ReadCloser, info *api.VersionInfo, mod io.Reader) error {
+	keys := map[string]string{}
+	for _, file := range []string{"source.zip", "go.mod", "version.info"} {
+		key, err := s.versionKey(module, version, file)
+		if err != nil {
+			return err
+		}
+		keys[file] = key
+	}
+
+	exists, err := s.objectExists(keys["version.info"])
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return services.NewErrVersionExists(module, version)
+	}
+
+	staged, err := stageModuleVersion(os.TempDir(), module, version, file, info, mod)
+	if err != nil {
+		return err
+	}
+	defer staged.Close()
+
+	// every file is only put when it isn't there yet, so concurrent uploads
+	// of a version can't overwrite one another's files. Identical uploads
+	// carry on, so an interrupted upload can be retried, and the first to
+	// put version.info publishes the version
+	stagedFiles := map[string]string{"source.zip": staged.zipFile, "go.mod": staged.modFile}
+	for _, file := range []string{"source.zip", "go.mod"} {
+		err = s.claimFile(keys[file], stagedFiles[file])
+		if err != nil {
+			if services.KindOf(err) == services.KindConflict {
+				return s.conflict(keys["version.info"], module, version)
+			}
+			return errors.Wrapf(err, "failed uploading %s file", file)
+		}
+	}
+
+	put, err := s.putFileIfAbsent(keys["version.info"], staged.versionInfoFile)
+	if err != nil {
+		return errors.Wrap(err, "failed uploading version.info file")
+	}
+	if !put {
+		return services.NewErrVersionExists(module, version)
+	}
+
+	return nil
+}
+
+// claimFile puts file at key, unless an object is there already in which
+// case it must have the same content.
+func (s *S3Storage) claimFile(key, file string) error {
+	put, err := s.putFileIfAbsent(key, file)
+	if err != nil || put {
+		return err
+	}
+
+	same, err := s.sameContent(key, file)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return services.NewErrConflict("%s holds different content", key)
+	}
+
+	return nil
+}
+
+// conflict is the error of an upload whose files clash with another upload
+// of the version.
+func (s *S3Storage) conflict(infoKey, module, version string) error {
+	exists, err := s.objectExists(infoKey)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return services.NewErrVersionExists(module, version)
+	}
+
+	return services.NewErrConflict("a different upload of %s@%s is in progress or was interrupted, its files must be deleted from the bucket before it can be uploaded again", module, version)
+}
+
+func (s *S3Storage) DeleteModuleVersion(module, version string) error {
+	keys := []string{}
+	// version.info is deleted first so the version stops being listed
+	// before its files go
+	for _, file := range []string{"version.info", "source.zip", "go.mod"} {
+		key, err := s.versionKey(module, version, file)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	// look for every file so deleting again finishes a delete that failed
+	// part way
+	found := false
+	for _, key := range keys {
+		exists, err := s.objectExists(key)
+		if err != nil {
+			return err
+		}
+		found = found || exists
+	}
+
+	if !found {
+		return services.NewErrVersionDoesntExist(module, version)
+	}
+
+	for _, key := range keys {
+		_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed deleting %s", key)
+		}
+	}
+
+	return nil
+}
+
+// Metadata reads the module's metadata from the metadata.json object next to
+// its versions.
+func (s *S3Storage) Metadata(module string) (*api.ModuleMetadata, error) {
+	moduleKey, err := s.moduleKey(module)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(moduleKey + "metadata.json"),
+	})
+	if isNotFound(err) {
+		return &api.ModuleMetadata{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed getting metadata.json")
+	}
+	defer out.Body.Close()
+
+	dat, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading metadata.json")
+	}
+
+	var metadata api.ModuleMetadata
+	err = json.Unmarshal(dat, &metadata)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed unmarshalling ModuleMetadata")
+	}
+
+	return &metadata, nil
+}
+
+func (s *S3Storage) SetMetadata(module string, metadata *api.ModuleMetadata) error {
+	moduleKey, err := s.moduleKey(module)
+	if err != nil {
+		return err
+	}
+
+	hasModule, err := s.HasModule(module)
+	if err != nil {
+		return err
+	}
+
+	if !hasModule {
+		return services.NewErrModuleDoesntExist(module)
+	}
+
+	dat, err := json.Marshal(metadata)
+	if err != nil {
+		return errors.Wrap(err, "failed marshalling ModuleMetadata")
+	}
+
+	_, err = s.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(moduleKey + "metadata.json"),
+		Body:   bytes.NewReader(dat),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed uploading metadata.json")
+	}
+
+	return nil
+}
+
+// Ready checks that the bucket is reachable and writable, by writing and
+// deleting a probe object under the prefix.
+func (s *S3Storage) Ready(ctx context.Context) error {
+	key := s.prefix + ".ready"
+
+	_, err := s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader([]byte("ok")),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed writing to bucket %s", s.bucket)
+	}
+
+	_, err = s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed deleting from bucket %s", s.bucket)
+	}
+
+	return nil
+}
+
+// moduleKey is the prefix of the keys of every version of the module.
+func (s *S3Storage) moduleKey(module string) (string, error) {
+	escaped, err := gomodule.EscapePath(module)
+	if err != nil {
+		return "", services.NewErrInvalid("%v", err)
+	}
+
+	return s.prefix + escaped + "/@v/", nil
+}
+
+func (s *S3Storage) versionKey(module, version, file string) (string, error) {
+	moduleKey, err := s.moduleKey(module)
+	if err != nil {
+		return "", err
+	}
+
+	escaped, err := gomodule.EscapeVersion(version)
+	if err != nil {
+		return "", services.NewErrInvalid("%v", err)
+	}
+
+	return moduleKey + escaped + "/" + file, nil
+}
+
+func (s *S3Storage) objectExists(key string) (bool, error) {
+	_, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		return true, nil
+	}
+
+	if isNotFound(err) {
+		return false, nil
+	}
+
+	return false, errors.Wrapf(err, "failed checking for %s", key)
+}
+
+// putFileIfAbsent puts file at key unless an object is there already,
+// reporting whether it was put. The If-None-Match condition makes this
+// atomic, S3 rejects the put when another one got there first.
+func (s *S3Storage) putFileIfAbsent(key, file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	req, _ := s.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   f,
+	})
+	req.HTTPRequest.Header.Set("If-None-Match", "*")
+
+	err = req.Send()
+	if failure, ok := err.(awserr.RequestFailure); ok {
+		// 409 is returned when a conflicting put is still in progress
+		if failure.StatusCode() == 412 || failure.StatusCode() == 409 {
+			return false, nil
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// sameContent reports whether the object at key holds the content of file.
+func (s *S3Storage) sameContent(key, file string) (bool, error) {
+	fileHash, err := hashFile(file)
+	if err != nil {
+		return false, err
+	}
+
+	out, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "failed getting %s", key)
+	}
+	defer out.Body.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, out.Body)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed reading %s", key)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)) == fileHash, nil
+}
+
+func (s *S3Storage) openObject(key string) (io.ReadSeekCloser, *time.Time, error) {
+	head, err := s.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader := &s3ObjectReader{
+		client: s.client,
+		bucket: s.bucket,
+		key:    key,
+		size:   aws.Int64Value(head.ContentLength),
+	}
+
+	modTime := aws.TimeValue(head.LastModified)
+
+	return reader, &modTime, nil
+}
+
+func isNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+
+	switch aerr.Code() {
+	case s3.ErrCodeNoSuchKey, "NotFound":
+		return true
+	}
+
+	return false
+}
+
+// s3ObjectReader reads an object with ranged GETs so it can be seeked by
+// http.ServeContent without buffering the whole object in memory. It must be
+// closed to release the connection of a GET that wasn't read to the end.
+type s3ObjectReader struct {
+	client *s3.S3
+	bucket string
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *s3ObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		out, err := r.client.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(r.bucket),
+			Key:    aws.String(r.key),
+			Range:  aws.String(fmt.Sprintf("bytes=%d-", r.offset)),
+		})
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed getting %s", r.key)
+		}
+		r.body = out.Body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+
+	if err == io.EOF {
+		r.body.Close()
+		r.body = nil
+
+		if r.offset < r.size {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+
+	return n, err
+}
+
+func (r *s3ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	var next int64
+
+	switch whence {
+	case io.SeekStart:
+		next = offset
+	case io.SeekCurrent:
+		next = r.offset + offset
+	case io.SeekEnd:
+		next = r.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+
+	if next < 0 {
+		return 0, fmt.Errorf("negative position %d", next)
+	}
+
+	if next != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = next
+
+	return next, nil
+}
+
+func (r *s3ObjectReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
@@ -0,0 +1,225 @@
+package storage_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+	"github.com/annymsmthd/go-modules-registry/pkg/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func moduleZip(t *testing.T, prefix string, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	for name, contents := range files {
+		f, err := w.Create(prefix + name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func newTestS3Storage(t *testing.T, fake *FakeS3) *storage.S3Storage {
+	s, err := storage.NewS3Storage(&storage.S3Config{
+		Endpoint:        fake.URL(),
+		Region:          "us-east-1",
+		Bucket:          "modules",
+		Prefix:          "registry",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+	})
+	require.NoError(t, err)
+
+	return s
+}
+
+func TestS3StorageCreateAndReadModuleVersion(t *testing.T) {
+	fake := NewFakeS3("modules")
+	defer fake.Close()
+
+	s := newTestS3Storage(t, fake)
+	version := "v1.0.0"
+
+	source := moduleZip(t, "test.com/module@v1.0.0/", map[string]string{
+		"go.mod":  "module test.com/module\n",
+		"main.go": "package module\n",
+	})
+
+	err := s.CreateModuleVersion("test.com/module", version, ioutil.NopCloser(bytes.NewReader(source)))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"registry/test.com/module/@v/v1.0.0/go.mod",
+		"registry/test.com/module/@v/v1.0.0/source.zip",
+		"registry/test.com/module/@v/v1.0.0/version.info",
+	}, fake.Keys())
+
+	hasModule, err := s.HasModule("test.com/module")
+	require.NoError(t, err)
+	assert.True(t, hasModule)
+
+	hasModule, err = s.HasModule("test.com/other")
+	require.NoError(t, err)
+	assert.False(t, hasModule)
+
+	versions, err := s.ModuleVersions("test.com/module")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0"}, versions)
+
+	info, err := s.VersionInfo("test.com/module", version)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.0.0", info.Version)
+
+	mod, _, err := s.Mod("test.com/module", version)
+	require.NoError(t, err)
+	defer mod.Close()
+	modBytes, err := ioutil.ReadAll(mod)
+	require.NoError(t, err)
+	assert.Equal(t, "module test.com/module\n", string(modBytes))
+
+	zipReader, _, err := s.Source("test.com/module", version)
+	require.NoError(t, err)
+	defer zipReader.Close()
+	_, err = zipReader.Seek(10, 0)
+	require.NoError(t, err)
+	zipBytes, err := ioutil.ReadAll(zipReader)
+	require.NoError(t, err)
+	assert.Equal(t, source[10:], zipBytes)
+}
+
+func TestS3StorageRejectsExistingVersion(t *testing.T) {
+	fake := NewFakeS3("modules")
+	defer fake.Close()
+
+	s := newTestS3Storage(t, fake)
+	version := "v1.0.0"
+
+	source := moduleZip(t, "test.com/module@v1.0.0/", map[string]string{
+		"go.mod": "module test.com/module\n",
+	})
+
+	err := s.CreateModuleVersion("test.com/module", version, ioutil.NopCloser(bytes.NewReader(source)))
+	require.NoError(t, err)
+
+	err = s.CreateModuleVersion("test.com/module", version, ioutil.NopCloser(bytes.NewReader(source)))
+	assert.IsType(t, services.NewErrVersionExists("", ""), err)
+}
+
+func TestS3StorageNeverOverwritesAnotherUpload(t *testing.T) {
+	fake := NewFakeS3("modules")
+	defer fake.Close()
+
+	s := newTestS3Storage(t, fake)
+
+	sources := [][]byte{}
+	for i := 0; i < 5; i++ {
+		sources = append(sources, moduleZip(t, "test.com/module@v1.0.0/", map[string]string{
+			"go.mod":  "module test.com/module\n",
+			"main.go": fmt.Sprintf("package module // %d\n", i),
+		}))
+	}
+
+	// only one of several different uploads at once gets stored
+	errs := make(chan error, len(sources))
+	for _, source := range sources {
+		go func(source []byte) {
+			errs <- s.CreateModuleVersion("test.com/module", "v1.0.0", ioutil.NopCloser(bytes.NewReader(source)))
+		}(source)
+	}
+
+	stored := 0
+	for range sources {
+		err := <-errs
+		if err == nil {
+			stored++
+		} else {
+			assert.Equal(t, services.KindConflict, services.KindOf(err))
+		}
+	}
+	assert.Equal(t, 1, stored)
+
+	zipKey := "registry/test.com/module/@v/v1.0.0/source.zip"
+	winner := fake.objects[zipKey].data
+
+	// an interrupted upload can be retried with the same source, but not
+	// replaced by a different one
+	delete(fake.objects, "registry/test.com/module/@v/v1.0.0/version.info")
+
+	other := sources[0]
+	if bytes.Equal(other, winner) {
+		other = sources[1]
+	}
+	err := s.CreateModuleVersion("test.com/module", "v1.0.0", ioutil.NopCloser(bytes.NewReader(other)))
+	assert.Equal(t, services.KindConflict, services.KindOf(err))
+	assert.Equal(t, winner, fake.objects[zipKey].data)
+
+	err = s.CreateModuleVersion("test.com/module", "v1.0.0", ioutil.NopCloser(bytes.NewReader(winner)))
+	assert.NoError(t, err)
+}
+
+func TestS3StorageRejectsMismatchedModule(t *testing.T) {
+	fake := NewFakeS3("modules")
+	defer fake.Close()
+
+	s := newTestS3Storage(t, fake)
+
+	source := moduleZip(t, "test.com/module@v1.0.0/", map[string]string{
+		"go.mod": "module test.com/other\n",
+	})
+
+	err := s.CreateModuleVersion("test.com/module", "v1.0.0", ioutil.NopCloser(bytes.NewReader(source)))
+	assert.Error(t, err)
+	assert.Empty(t, fake.Keys())
+}
+
+func TestS3StorageDeletesModuleVersionAndKeepsMetadata(t *testing.T) {
+	fake := NewFakeS3("modules")
+	defer fake.Close()
+
+	s := newTestS3Storage(t, fake)
+
+	source := moduleZip(t, "test.com/module@v1.0.0/", map[string]string{
+		"go.mod": "module test.com/module\n",
+	})
+
+	err := s.CreateModuleVersion("test.com/module", "v1.0.0", ioutil.NopCloser(bytes.NewReader(source)))
+	require.NoError(t, err)
+
+	err = s.SetMetadata("test.com/module", &api.ModuleMetadata{Deletions: map[string]*api.Deletion{"v1.0.0": {Reason: "leaked secret"}}})
+	require.NoError(t, err)
+
+	err = s.DeleteModuleVersion("test.com/module", "v1.0.0")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"registry/test.com/module/@v/metadata.json"}, fake.Keys())
+
+	metadata, err := s.Metadata("test.com/module")
+	require.NoError(t, err)
+	assert.Equal(t, "leaked secret", metadata.Deletions["v1.0.0"].Reason)
+
+	err = s.DeleteModuleVersion("test.com/module", "v1.0.0")
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+}
+
+func TestS3StorageReadyWritesAndRemovesAProbe(t *testing.T) {
+	fake := NewFakeS3("modules")
+	defer fake.Close()
+	s := newTestS3Storage(t, fake)
+
+	require.NoError(t, s.Ready(context.Background()))
+	assert.Empty(t, fake.Keys())
+
+	fake.Close()
+	assert.Error(t, s.Ready(context.Background()))
+}
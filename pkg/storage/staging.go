@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	modzip "golang.org/x/mod/zip"
+)
+
+// stagedVersion is an uploaded module version that has been written to a
+// working directory and validated, ready to be moved into a storage backend.
+type stagedVersion struct {
+	workDir         string
+	zipFile         string
+	modFile         string
+	versionInfoFile string
+}
+
+// stageModuleVersion writes the uploaded source.zip into a new working
+// directory under tmpDir, extracts and checks its go.mod and writes the
+// version.info for it. Versions pulled from an upstream pass the info and
+// go.mod the upstream serves, which are kept instead, otherwise they are nil.
+// The caller must call Close to clean up the working directory.
+func stageModuleVersion(tmpDir, module, version string, file io.Reader, info *api.VersionInfo, mod io.Reader) (*stagedVersion, error) {
+	if _, err := os.Stat(tmpDir); err != nil {
+		err = os.Mkdir(tmpDir, os.ModePerm)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed creating tmp directory")
+		}
+	}
+
+	id := uuid.New()
+	workDir := path.Join(tmpDir, id.String())
+
+	err := os.Mkdir(workDir, os.ModePerm)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed creating working directory")
+	}
+
+	staged := &stagedVersion{workDir: workDir}
+
+	err = staged.stage(module, version, file, info, mod)
+	if err != nil {
+		staged.Close()
+		return nil, err
+	}
+
+	return staged, nil
+}
+
+func (v *stagedVersion) stage(module, version string, file io.Reader, info *api.VersionInfo, mod io.Reader) error {
+	zipFile := path.Join(v.workDir, "source.zip")
+	source, err := os.Create(zipFile)
+	if err != nil {
+		return errors.Wrap(err, "failed creating source.zip file")
+	}
+	defer source.Close()
+
+	// stop copying past the limit, checkModuleZip rejects zips this large
+	_, err = io.Copy(source, io.LimitReader(file, modzip.MaxZipFile+1))
+	if err != nil {
+		return errors.Wrap(err, "failed copying file to source.zip")
+	}
+
+	err = source.Close()
+	if err != nil {
+		return errors.Wrap(err, "failed closing source")
+	}
+	v.zipFile = zipFile
+
+	err = checkModuleZip(zipFile, module, version)
+	if err != nil {
+		return err
+	}
+
+	// the go.mod of an upstream version can differ from the one in its zip,
+	// such as the synthesized go.mod of +incompatible versions
+	var modFile string
+	if mod != nil {
+		modFile, err = writeModFile(v.workDir, mod)
+	} else {
+		modFile, err = extractModFile(v.workDir, zipFile, module, version)
+	}
+	if err != nil {
+		return err
+	}
+	v.modFile = modFile
+
+	modName, err := ModName(modFile)
+	if err != nil {
+		return err
+	}
+
+	if modName != module {
+		return services.NewErrInvalid("module %s in go.mod must match module %s given", modName, module)
+	}
+
+	published := time.Now()
+	if info != nil && !info.Time.IsZero() {
+		published = info.Time
+	}
+
+	versionInfo := api.VersionInfo{
+		Name:    version,
+		Short:   version,
+		Time:    published,
+		Version: version,
+	}
+
+	versionBytes, err := json.Marshal(versionInfo)
+	if err != nil {
+		return errors.Wrap(err, "failed marshaling version info")
+	}
+
+	versionInfoFile := path.Join(v.workDir, "version.info")
+	vf, err := os.Create(versionInfoFile)
+	if err != nil {
+		return errors.Wrap(err, "failed creating version info file")
+	}
+	defer vf.Close()
+
+	_, err = vf.Write(versionBytes)
+	if err != nil {
+		return errors.Wrap(err, "failed writing version info bytes")
+	}
+
+	err = vf.Close()
+	if err != nil {
+		return errors.Wrap(err, "failed closing version info file")
+	}
+	v.versionInfoFile = versionInfoFile
+
+	return nil
+}
+
+func writeModFile(workDir string, mod io.Reader) (string, error) {
+	modFile := path.Join(workDir, "go.mod")
+	f, err := os.Create(modFile)
+	if err != nil {
+		return "", errors.Wrap(err, "failed creating go.mod")
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, mod)
+	if err != nil {
+		return "", errors.Wrap(err, "failed writing go.mod")
+	}
+
+	err = f.Close()
+	if err != nil {
+		return "", errors.Wrap(err, "failed closing go.mod")
+	}
+
+	return modFile, nil
+}
+
+// Close removes the working directory and everything left in it.
+func (v *stagedVersion) Close() error {
+	return os.RemoveAll(v.workDir)
+}
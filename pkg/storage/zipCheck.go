@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/module"
+	modzip "golang.org/x/mod/zip"
+)
+
+// checkModuleZip checks zipFile against the rules the go command enforces
+// when extracting module zips. Files the go command leaves out when creating
+// a module zip, such as vendored packages and nested modules, are rejected
+// too since a zip containing them can't have been made by the go command.
+func checkModuleZip(zipFile, modulePath, version string) error {
+	checked, err := modzip.CheckZip(module.Version{Path: modulePath, Version: version}, zipFile)
+	if err != nil && checked.SizeError == nil && len(checked.Invalid) == 0 {
+		return services.NewErrInvalid("source is not a valid module zip: %v", err)
+	}
+
+	violations := []string{}
+	if checked.SizeError != nil {
+		violations = append(violations, checked.SizeError.Error())
+	}
+	for _, invalid := range checked.Invalid {
+		violations = append(violations, invalid.Error())
+	}
+
+	// a module zip too large to check file by file has been reported already
+	if checked.SizeError == nil || len(checked.Valid) > 0 {
+		omitted, err := omittedFiles(zipFile, modulePath+"@"+version+"/")
+		if err != nil {
+			return err
+		}
+		violations = append(violations, omitted...)
+	}
+
+	if len(violations) > 0 {
+		return services.NewErrInvalidModuleZip(modulePath, version, violations)
+	}
+
+	return nil
+}
+
+// omittedFiles lists the files in a module zip under prefix that the go
+// command would never have put into it.
+func omittedFiles(zipFile, prefix string) ([]string, error) {
+	reader, err := zip.OpenReader(zipFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed opening module zip")
+	}
+	defer reader.Close()
+
+	nestedModules := []string{}
+	for _, file := range reader.File {
+		name := strings.TrimPrefix(file.Name, prefix)
+		if name != file.Name && name != "go.mod" && path.Base(name) == "go.mod" {
+			nestedModules = append(nestedModules, path.Dir(name)+"/")
+		}
+	}
+
+	violations := []string{}
+	for _, file := range reader.File {
+		// files outside of the prefix are reported by CheckZip
+		if !strings.HasPrefix(file.Name, prefix) {
+			continue
+		}
+		name := file.Name[len(prefix):]
+
+		switch {
+		case file.Mode()&os.ModeSymlink != 0:
+			violations = append(violations, fmt.Sprintf("%s: symbolic links are not allowed", file.Name))
+		case isVendoredPackage(name):
+			violations = append(violations, fmt.Sprintf("%s: vendored packages are not allowed, only vendor/modules.txt", file.Name))
+		case path.Base(name) != "go.mod":
+			// nested go.mod files themselves are reported by CheckZip
+			for _, dir := range nestedModules {
+				if strings.HasPrefix(name, dir) {
+					violations = append(violations, fmt.Sprintf("%s: file belongs to the nested module in %s", file.Name, strings.TrimSuffix(dir, "/")))
+					break
+				}
+			}
+		}
+	}
+
+	return violations, nil
+}
+
+// isVendoredPackage reports whether the go command leaves name out of module
+// zips as part of a vendored package, matching golang.org/x/mod/zip
+// including its handling of nested vendor directories.
+func isVendoredPackage(name string) bool {
+	var i int
+	if strings.HasPrefix(name, "vendor/") {
+		i += len("vendor/")
+	} else if j := strings.Index(name, "/vendor/"); j >= 0 {
+		// not j+len("/vendor/"), the go command can't change this without
+		// invalidating module checksums
+		i += len("/vendor/")
+	} else {
+		return false
+	}
+	return strings.Contains(name[i:], "/")
+}
@@ -0,0 +1,129 @@
+package uploader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
+
+	"github.com/pkg/errors"
+	gomodule "golang.org/x/mod/module"
+)
+
+// Admin manages published modules in a registry, authenticating like
+// Uploader with token when given and otherwise with .netrc.
+type Admin struct {
+	registry string
+	token    string
+}
+
+func NewAdmin(registry, token string) *Admin {
+	return &Admin{registry, token}
+}
+
+func (a *Admin) Retract(module, version, reason string) error {
+	url, err := a.versionURL(module, version, "retraction")
+	if err != nil {
+		return err
+	}
+
+	return a.do(http.MethodPut, url, &api.RetractRequest{Reason: reason})
+}
+
+func (a *Admin) Unretract(module, version string) error {
+	url, err := a.versionURL(module, version, "retraction")
+	if err != nil {
+		return err
+	}
+
+	return a.do(http.MethodDelete, url, nil)
+}
+
+func (a *Admin) Deprecate(module, message string) error {
+	url, err := a.moduleURL(module, "@deprecation")
+	if err != nil {
+		return err
+	}
+
+	return a.do(http.MethodPut, url, &api.DeprecateRequest{Message: message})
+}
+
+func (a *Admin) Undeprecate(module string) error {
+	url, err := a.moduleURL(module, "@deprecation")
+	if err != nil {
+		return err
+	}
+
+	return a.do(http.MethodDelete, url, nil)
+}
+
+// Delete removes the version from the registry for good, it can never be
+// uploaded again.
+func (a *Admin) Delete(module, version, reason string) error {
+	escapedVersion, err := gomodule.EscapeVersion(version)
+	if err != nil {
+		return errors.Wrap(err, "invalid version")
+	}
+
+	url, err := a.moduleURL(module, "@v/"+escapedVersion)
+	if err != nil {
+		return err
+	}
+
+	return a.do(http.MethodDelete, url, &api.DeleteRequest{Reason: reason})
+}
+
+func (a *Admin) moduleURL(module, endpoint string) (string, error) {
+	escapedModule, err := gomodule.EscapePath(module)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid module path")
+	}
+
+	return fmt.Sprintf("%s/_modules/%s/%s", a.registry, escapedModule, endpoint), nil
+}
+
+func (a *Admin) versionURL(module, version, endpoint string) (string, error) {
+	escapedVersion, err := gomodule.EscapeVersion(version)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid version")
+	}
+
+	return a.moduleURL(module, "@v/"+escapedVersion+"/"+endpoint)
+}
+
+func (a *Admin) do(method, url string, request interface{}) error {
+	var body io.Reader
+	if request != nil {
+		dat, err := json.Marshal(request)
+		if err != nil {
+			return errors.Wrap(err, "failed marshalling request")
+		}
+		body = bytes.NewReader(dat)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return errors.Wrap(err, "failed creating request")
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	authorize(req, a.token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed sending request to registry")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 204 {
+		responseBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("expected status code 204 but got %v for url %s: %s", resp.StatusCode, url, string(responseBody))
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package uploader
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+type netrcLine struct {
+	machine  string
+	login    string
+	password string
+}
+
+// netrcCredentials returns the login and password for host from the netrc
+// file the go command would use, $NETRC or .netrc in the home directory.
+func netrcCredentials(host string) (string, string, bool) {
+	file := os.Getenv("NETRC")
+	if file == "" {
+		home, err := homeDir()
+		if err != nil {
+			return "", "", false
+		}
+		name := ".netrc"
+		if runtime.GOOS == "windows" {
+			name = "_netrc"
+		}
+		file = filepath.Join(home, name)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", "", false
+	}
+
+	for _, l := range parseNetrc(string(data)) {
+		if l.machine == host {
+			return l.login, l.password, true
+		}
+	}
+
+	return "", "", false
+}
+
+func homeDir() (string, error) {
+	if home := os.Getenv("HOME"); home != "" {
+		return home, nil
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	return u.HomeDir, nil
+}
+
+// parseNetrc parses the machine entries of a netrc file, like the go command
+// it stops at the default entry and skips macdef definitions.
+func parseNetrc(data string) []netrcLine {
+	var lines []netrcLine
+	var l netrcLine
+	inMacro := false
+
+	for _, line := range strings.Split(data, "\n") {
+		if inMacro {
+			if line == "" {
+				inMacro = false
+			}
+			continue
+		}
+
+		f := strings.Fields(line)
+		i := 0
+		for ; i < len(f)-1; i += 2 {
+			// reset at each "machine" token
+			switch f[i] {
+			case "machine":
+				l = netrcLine{machine: f[i+1]}
+			case "default":
+				return lines
+			case "login":
+				l.login = f[i+1]
+			case "password":
+				l.password = f[i+1]
+			case "macdef":
+				inMacro = true
+			}
+			if l.machine != "" && l.login != "" && l.password != "" {
+				lines = append(lines, l)
+				l = netrcLine{}
+			}
+		}
+
+		if i < len(f) && f[i] == "default" {
+			return lines
+		}
+	}
+
+	return lines
+}
@@ -1,68 +1,235 @@
 package uploader
 
 import (
+	"archive/tar"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 
 	"github.com/annymsmthd/go-modules-registry/pkg/storage"
 
-	"github.com/coreos/go-semver/semver"
 	"github.com/pkg/errors"
+	gomodule "golang.org/x/mod/module"
+	modzip "golang.org/x/mod/zip"
 )
 
 type Uploader struct {
 	registry       string
 	moduleLocation string
-	version        *semver.Version
+	version        string
+	gitRevision    string
+	token          string
 }
 
-func NewUploader(registry, moduleLocation string, version *semver.Version) *Uploader {
-	return &Uploader{registry, moduleLocation, version}
+// NewUploader creates an Uploader for the module in moduleLocation. The
+// module zip is built from the files in the directory, unless gitRevision is
+// given in which case it is built from the files committed at that revision.
+// Uploads are authenticated with token when given, otherwise with the
+// credentials for the registry host in .netrc if there are any.
+func NewUploader(registry, moduleLocation, version, gitRevision, token string) *Uploader {
+	return &Uploader{registry, moduleLocation, version, gitRevision, token}
 }
 
-func (u *Uploader) Upload() error {
-	modLocation := path.Join(u.moduleLocation, "go.mod")
+// Upload builds the module zip following the rules of the go command and
+// uploads it, returning the files that were left out of it and why.
+func (u *Uploader) Upload() ([]modzip.FileError, error) {
+	dir := u.moduleLocation
+	if u.gitRevision != "" {
+		exportDir, err := u.exportRevision()
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(exportDir)
+		dir = exportDir
+	}
+
+	modLocation := path.Join(dir, "go.mod")
 	_, err := os.Stat(modLocation)
 	if err != nil {
-		return errors.Wrap(err, "error finding go.mod file")
+		return nil, errors.Wrap(err, "error finding go.mod file")
 	}
 
 	moduleName, err := storage.ModName(modLocation)
 	if err != nil {
-		return errors.Wrap(err, "failed getting mod name")
+		return nil, errors.Wrap(err, "failed getting mod name")
 	}
 
-	zipLocation := path.Join(u.moduleLocation, "source.zip")
+	escapedModule, err := gomodule.EscapePath(moduleName)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid module path")
+	}
 
-	cmd := exec.Command("git", "archive", "-o", "source.zip", "--prefix", fmt.Sprintf("%s@v%s/", moduleName, u.version.String()), "HEAD")
-	cmd.Dir = u.moduleLocation
+	escapedVersion, err := gomodule.EscapeVersion(u.version)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid version")
+	}
 
-	err = cmd.Run()
+	checked, err := modzip.CheckDir(dir)
+	excluded := relativePaths(dir, checked.Omitted)
 	if err != nil {
-		return errors.Wrap(err, "error archiving module location")
+		return excluded, errors.Wrap(err, "module can't be zipped")
 	}
-	defer os.Remove(zipLocation)
 
-	f, err := os.Open(zipLocation)
+	f, err := ioutil.TempFile("", "source-*.zip")
 	if err != nil {
-		return errors.Wrap(err, "failed opening source.zip")
+		return excluded, errors.Wrap(err, "failed creating source.zip")
 	}
+	defer os.Remove(f.Name())
 	defer f.Close()
 
-	url := fmt.Sprintf("%s/_modules/%s/@v/v%s", u.registry, moduleName, u.version.String())
-	resp, err := http.Post(url, "", f)
+	err = modzip.CreateFromDir(f, gomodule.Version{Path: moduleName, Version: u.version}, dir)
+	if err != nil {
+		return excluded, errors.Wrap(err, "failed zipping module")
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return excluded, errors.Wrap(err, "failed rewinding source.zip")
+	}
+
+	url := fmt.Sprintf("%s/_modules/%s/@v/%s", u.registry, escapedModule, escapedVersion)
+
+	req, err := http.NewRequest(http.MethodPost, url, f)
 	if err != nil {
-		return errors.Wrap(err, "failed posting module to registry")
+		return excluded, errors.Wrap(err, "failed creating upload request")
 	}
+	authorize(req, u.token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return excluded, errors.Wrap(err, "failed posting module to registry")
+	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 201 {
 		responseBody, _ := ioutil.ReadAll(resp.Body)
-		return fmt.Errorf("expected status code 201 but got %v for url %s: %s", resp.StatusCode, url, string(responseBody))
+		return excluded, fmt.Errorf("expected status code 201 but got %v for url %s: %s", resp.StatusCode, url, string(responseBody))
+	}
+
+	return excluded, nil
+}
+
+// authorize authenticates req with token when given, otherwise with the
+// credentials for its host in .netrc if there are any.
+func authorize(req *http.Request, token string) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return
+	}
+
+	login, password, ok := netrcCredentials(req.URL.Hostname())
+	if ok {
+		req.SetBasicAuth(login, password)
+	}
+}
+
+// exportRevision writes the files of the module directory at the git
+// revision into a temporary directory.
+func (u *Uploader) exportRevision() (string, error) {
+	exportDir, err := ioutil.TempDir("", "module")
+	if err != nil {
+		return "", errors.Wrap(err, "failed creating export directory")
+	}
+
+	// run in the module directory, git archive only includes the current
+	// directory of the repository
+	cmd := exec.Command("git", "archive", "--format=tar", u.gitRevision)
+	cmd.Dir = u.moduleLocation
+	cmd.Stderr = os.Stderr
+
+	archive, err := cmd.StdoutPipe()
+	if err != nil {
+		os.RemoveAll(exportDir)
+		return "", errors.Wrap(err, "failed running git archive")
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		os.RemoveAll(exportDir)
+		return "", errors.Wrap(err, "failed running git archive")
+	}
+
+	extractErr := extractTar(archive, exportDir)
+	// drain the archive so git doesn't block when extracting failed
+	io.Copy(ioutil.Discard, archive)
+
+	err = cmd.Wait()
+	if err != nil {
+		os.RemoveAll(exportDir)
+		return "", errors.Wrapf(err, "failed archiving revision %s", u.gitRevision)
 	}
 
-	return nil
+	if extractErr != nil {
+		os.RemoveAll(exportDir)
+		return "", extractErr
+	}
+
+	return exportDir, nil
+}
+
+func extractTar(r io.Reader, dir string) error {
+	reader := tar.NewReader(r)
+
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed reading git archive")
+		}
+
+		name := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+header.Name)))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(name, os.ModePerm)
+		case tar.TypeSymlink:
+			// kept so the go command's rules leave them out of the zip
+			err = os.Symlink(header.Linkname, name)
+		case tar.TypeReg:
+			err = extractFile(reader, name, os.FileMode(header.Mode))
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed extracting %s", header.Name)
+		}
+	}
+}
+
+func extractFile(r io.Reader, name string, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(name), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// relativePaths makes the paths CheckDir reports relative to dir, which
+// may be a temporary directory.
+func relativePaths(dir string, fileErrors []modzip.FileError) []modzip.FileError {
+	relative := make([]modzip.FileError, 0, len(fileErrors))
+	for _, fe := range fileErrors {
+		if rel, err := filepath.Rel(dir, fe.Path); err == nil {
+			fe.Path = filepath.ToSlash(rel)
+		}
+		relative = append(relative, fe)
+	}
+	return relative
 }
@@ -0,0 +1,142 @@
+package uploader_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/uploader"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestModuleDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "module")
+	require.NoError(t, err)
+
+	files := map[string]string{
+		"go.mod":                   "module test.com/module\n",
+		"main.go":                  "package module\n",
+		"vendor/modules.txt":       "",
+		"vendor/test.com/dep/a.go": "package dep\n",
+		"sub/go.mod":               "module test.com/module/sub\n",
+		"sub/sub.go":               "package sub\n",
+	}
+	for name, contents := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), os.ModePerm))
+		require.NoError(t, ioutil.WriteFile(file, []byte(contents), 0644))
+	}
+
+	return dir
+}
+
+func newTestRegistry(t *testing.T, uploads map[string][]byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		uploads[r.URL.Path] = body
+		uploads["authorization"] = []byte(r.Header.Get("Authorization"))
+		w.WriteHeader(201)
+	}))
+}
+
+func zipFiles(t *testing.T, source []byte) []string {
+	reader, err := zip.NewReader(bytes.NewReader(source), int64(len(source)))
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, f := range reader.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestUploaderZipsModuleDirectory(t *testing.T) {
+	dir := newTestModuleDir(t)
+	defer os.RemoveAll(dir)
+
+	uploads := map[string][]byte{}
+	registry := newTestRegistry(t, uploads)
+	defer registry.Close()
+
+	excluded, err := uploader.NewUploader(registry.URL, dir, "v1.0.0", "", "").Upload()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"test.com/module@v1.0.0/go.mod",
+		"test.com/module@v1.0.0/main.go",
+		"test.com/module@v1.0.0/vendor/modules.txt",
+	}, zipFiles(t, uploads["/_modules/test.com/module/@v/v1.0.0"]))
+
+	excludedPaths := []string{}
+	for _, e := range excluded {
+		excludedPaths = append(excludedPaths, e.Path)
+	}
+	assert.ElementsMatch(t, []string{"sub", "vendor/test.com/dep", "vendor/test.com/dep/a.go"}, excludedPaths)
+}
+
+func TestUploaderZipsGitRevision(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := newTestModuleDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "go.mod", "main.go"},
+		{"-c", "user.name=test", "-c", "user.email=test@test.com", "commit", "-q", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	uploads := map[string][]byte{}
+	registry := newTestRegistry(t, uploads)
+	defer registry.Close()
+
+	excluded, err := uploader.NewUploader(registry.URL, dir, "v1.0.0", "HEAD", "").Upload()
+	require.NoError(t, err)
+	assert.Empty(t, excluded)
+
+	assert.Equal(t, []string{
+		"test.com/module@v1.0.0/go.mod",
+		"test.com/module@v1.0.0/main.go",
+	}, zipFiles(t, uploads["/_modules/test.com/module/@v/v1.0.0"]))
+}
+
+func TestUploaderAuthenticates(t *testing.T) {
+	dir := newTestModuleDir(t)
+	defer os.RemoveAll(dir)
+
+	uploads := map[string][]byte{}
+	registry := newTestRegistry(t, uploads)
+	defer registry.Close()
+
+	_, err := uploader.NewUploader(registry.URL, dir, "v1.0.0", "", "secret").Upload()
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer secret", string(uploads["authorization"]))
+
+	netrc := filepath.Join(dir, "netrc")
+	require.NoError(t, ioutil.WriteFile(netrc, []byte("machine example.com login other password other\nmachine 127.0.0.1\n\tlogin ci\n\tpassword hunter2\n"), 0600))
+	os.Setenv("NETRC", netrc)
+	defer os.Unsetenv("NETRC")
+
+	_, err = uploader.NewUploader(registry.URL, dir, "v1.1.0", "", "").Upload()
+	require.NoError(t, err)
+	assert.Equal(t, "Basic Y2k6aHVudGVyMg==", string(uploads["authorization"]))
+}
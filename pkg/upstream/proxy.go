@@ -0,0 +1,134 @@
+package upstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/api"
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/module"
+)
+
+// Proxy fetches modules from a GOPROXY speaking the module proxy protocol.
+type Proxy struct {
+	url    string
+	client *http.Client
+}
+
+func NewProxy(url string) *Proxy {
+	return &Proxy{
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func (p *Proxy) List(modulePath string) ([]string, error) {
+	body, err := p.get(modulePath, "", "list")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	dat, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading upstream version list")
+	}
+
+	versions := []string{}
+	for _, line := range strings.Split(string(dat), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		versions = append(versions, fields[0])
+	}
+
+	return versions, nil
+}
+
+func (p *Proxy) Latest(modulePath string) (*api.VersionInfo, error) {
+	body, err := p.get(modulePath, "", "latest")
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeVersionInfo(body)
+}
+
+func (p *Proxy) VersionInfo(modulePath, version string) (*api.VersionInfo, error) {
+	body, err := p.get(modulePath, version, "info")
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeVersionInfo(body)
+}
+
+func (p *Proxy) Mod(modulePath, version string) (io.ReadCloser, error) {
+	return p.get(modulePath, version, "mod")
+}
+
+func (p *Proxy) Source(modulePath, version string) (io.ReadCloser, error) {
+	return p.get(modulePath, version, "zip")
+}
+
+func decodeVersionInfo(body io.ReadCloser) (*api.VersionInfo, error) {
+	defer body.Close()
+
+	var versionInfo api.VersionInfo
+	err := json.NewDecoder(body).Decode(&versionInfo)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed decoding upstream version info")
+	}
+
+	return &versionInfo, nil
+}
+
+// get requests one of the files of a module version from the proxy. Without a
+// version it requests the @v/list or @latest of the module instead.
+func (p *Proxy) get(modulePath, version, ext string) (io.ReadCloser, error) {
+	escapedPath, err := module.EscapePath(modulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/%s/@v/list", p.url, escapedPath)
+	if ext == "latest" {
+		url = fmt.Sprintf("%s/%s/@latest", p.url, escapedPath)
+	}
+
+	if version != "" {
+		escapedVersion, err := module.EscapeVersion(version)
+		if err != nil {
+			return nil, err
+		}
+		url = fmt.Sprintf("%s/%s/@v/%s.%s", p.url, escapedPath, escapedVersion, ext)
+	}
+
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed requesting %s", url)
+	}
+
+	switch {
+	case resp.StatusCode == 200:
+		return resp.Body, nil
+	case resp.StatusCode == 404 || resp.StatusCode == 410:
+		resp.Body.Close()
+		if version == "" {
+			return nil, services.NewErrModuleDoesntExist(modulePath)
+		}
+		return nil, services.NewErrVersionDoesntExist(modulePath, version)
+	default:
+		responseBody, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("expected status code 200 but got %v for url %s: %s", resp.StatusCode, url, string(responseBody))
+	}
+}
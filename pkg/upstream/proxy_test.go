@@ -0,0 +1,123 @@
+package upstream_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+	"github.com/annymsmthd/go-modules-registry/pkg/storage"
+	"github.com/annymsmthd/go-modules-registry/pkg/upstream"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestUpstream(t *testing.T, requests map[string]int) *httptest.Server {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	f, err := w.Create("test.com/Module@v1.0.0/go.mod")
+	require.NoError(t, err)
+	f.Write([]byte("module test.com/Module\n"))
+	require.NoError(t, w.Close())
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+
+		switch r.URL.Path {
+		case "/test.com/!module/@v/list":
+			fmt.Fprint(w, "v1.0.0\nv1.1.0\n")
+		case "/test.com/!module/@v/v1.0.0.info":
+			fmt.Fprint(w, `{"Version":"v1.0.0","Time":"2018-10-17T19:39:50Z"}`)
+		case "/test.com/!module/@v/v1.0.0.mod":
+			fmt.Fprint(w, "module test.com/Module\n\ngo 1.12\n")
+		case "/test.com/!module/@v/v1.0.0.zip":
+			w.Write(buf.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func newTestDownloadService(t *testing.T, url string) (*services.DownloadService, func()) {
+	dir, err := ioutil.TempDir("", "storage")
+	require.NoError(t, err)
+
+	fileStorage, err := storage.NewFileStorage(dir)
+	require.NoError(t, err)
+
+	service := services.NewDownloadService(fileStorage, nil, []*services.UpstreamRule{
+		{Pattern: "test.com", Upstream: upstream.NewProxy(url)},
+	}, nil, nil, nil)
+
+	return service, func() { os.RemoveAll(dir) }
+}
+
+func TestDownloadServicePullsThroughFromUpstream(t *testing.T) {
+	requests := map[string]int{}
+	server := newTestUpstream(t, requests)
+	defer server.Close()
+
+	service, cleanup := newTestDownloadService(t, server.URL)
+	defer cleanup()
+
+	version := "v1.0.0"
+
+	info, err := service.VersionInfo(context.Background(), "test.com/Module", version)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.0.0", info.Version)
+	assert.Equal(t, "2018-10-17T19:39:50Z", info.Time.Format(time.RFC3339))
+
+	// the upstream's go.mod is served rather than the one in the zip
+	mod, _, err := service.Mod(context.Background(), "test.com/Module", version)
+	require.NoError(t, err)
+	defer mod.Close()
+	modBytes, err := ioutil.ReadAll(mod)
+	require.NoError(t, err)
+	assert.Equal(t, "module test.com/Module\n\ngo 1.12\n", string(modBytes))
+
+	source, _, err := service.Source(context.Background(), "test.com/Module", version)
+	require.NoError(t, err)
+	defer source.Close()
+
+	assert.Equal(t, 1, requests["/test.com/!module/@v/v1.0.0.info"])
+	assert.Equal(t, 1, requests["/test.com/!module/@v/v1.0.0.zip"])
+
+	versions, err := service.ListVersions(context.Background(), "test.com/Module")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"v1.0.0", "v1.1.0"}, versions)
+}
+
+func TestDownloadServiceUpstreamMissingVersion(t *testing.T) {
+	server := newTestUpstream(t, map[string]int{})
+	defer server.Close()
+
+	service, cleanup := newTestDownloadService(t, server.URL)
+	defer cleanup()
+
+	_, err := service.VersionInfo(context.Background(), "test.com/Module", "v2.0.0")
+	assert.IsType(t, services.NewErrVersionDoesntExist("", ""), err)
+
+	_, err = service.ListVersions(context.Background(), "test.com/other")
+	assert.IsType(t, services.NewErrModuleDoesntExist(""), err)
+}
+
+func TestDownloadServiceOnlyProxiesMatchingModules(t *testing.T) {
+	requests := map[string]int{}
+	server := newTestUpstream(t, requests)
+	defer server.Close()
+
+	service, cleanup := newTestDownloadService(t, server.URL)
+	defer cleanup()
+
+	_, err := service.ListVersions(context.Background(), "example.com/module")
+	assert.IsType(t, services.NewErrModuleDoesntExist(""), err)
+	assert.Empty(t, requests)
+}
@@ -0,0 +1,50 @@
+package upstream
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/services"
+
+	"github.com/pkg/errors"
+)
+
+// SumDB fetches files from a checksum database over HTTP.
+type SumDB struct {
+	url    string
+	client *http.Client
+}
+
+func NewSumDB(url string) *SumDB {
+	return &SumDB{
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{Timeout: time.Minute},
+	}
+}
+
+func (s *SumDB) Get(path string) ([]byte, error) {
+	url := s.url + "/" + path
+
+	resp, err := s.client.Get(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed requesting %s", url)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed reading %s", url)
+	}
+
+	switch {
+	case resp.StatusCode == 200:
+		return body, nil
+	case resp.StatusCode == 404 || resp.StatusCode == 410:
+		return nil, services.NewErrNotFound("%s", strings.TrimSpace(string(body)))
+	default:
+		return nil, fmt.Errorf("expected status code 200 but got %v for url %s: %s", resp.StatusCode, url, string(body))
+	}
+}
@@ -0,0 +1,79 @@
+// Package watch reloads configuration kept in files when the files change.
+package watch
+
+import (
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Watcher reloads something kept in files whenever they change, until it is
+// closed.
+type Watcher struct {
+	what    string
+	reload  func() error
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// Files calls reload whenever one of files changes. The directories of the
+// files are watched as editors, cert-manager and kubernetes replace files
+// rather than write them. A failed reload is logged and is expected to leave
+// the last good what in place.
+func Files(what string, files []string, reload func() error) (*Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed watching %s", what)
+	}
+
+	watched := map[string]bool{}
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if watched[dir] {
+			continue
+		}
+		watched[dir] = true
+
+		err = watcher.Add(dir)
+		if err != nil {
+			watcher.Close()
+			return nil, errors.Wrapf(err, "failed watching %s", what)
+		}
+	}
+
+	w := &Watcher{what: what, reload: reload, watcher: watcher, done: make(chan struct{})}
+	go w.watch()
+
+	return w, nil
+}
+
+func (w *Watcher) watch() {
+	defer close(w.done)
+
+	for {
+		select {
+		case _, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			err := w.reload()
+			if err != nil {
+				logrus.WithError(err).Warnf("keeping the previous %s", w.what)
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			logrus.WithError(err).Errorf("failed watching %s", w.what)
+		}
+	}
+}
+
+// Close stops watching the files, returning once reloading has stopped.
+func (w *Watcher) Close() error {
+	err := w.watcher.Close()
+	<-w.done
+	return err
+}
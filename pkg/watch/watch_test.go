@@ -0,0 +1,49 @@
+package watch_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/annymsmthd/go-modules-registry/pkg/watch"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilesReloadsUntilClosed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte("a"), 0644))
+
+	var reloads int32
+	watcher, err := watch.Files("config", []string{file}, func() error {
+		atomic.AddInt32(&reloads, 1)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// replace the file like kubernetes would
+	tmp := filepath.Join(dir, "config.yaml.tmp")
+	require.NoError(t, ioutil.WriteFile(tmp, []byte("b"), 0644))
+	require.NoError(t, os.Rename(tmp, file))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&reloads) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NotZero(t, atomic.LoadInt32(&reloads))
+
+	require.NoError(t, watcher.Close())
+	closed := atomic.LoadInt32(&reloads)
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("c"), 0644))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, closed, atomic.LoadInt32(&reloads))
+}